@@ -2,6 +2,9 @@ package y_crdt
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"sort"
 )
 
 const (
@@ -20,3 +23,265 @@ func ReadAuthMessage(decoder *bytes.Buffer, doc *Doc, permissionDeniedHandler fu
 		permissionDeniedHandler(doc, reason)
 	}
 }
+
+// ErrReadOnly rejects every update of a read-only connection.
+var ErrReadOnly = errors.New("read-only")
+
+// UpdateAccess describes what an update of a connection changes, it is checked by a WritePolicy before the update
+// is applied.
+type UpdateAccess struct {
+	Conn       interface{} // identity of the connection that sent the update
+	Clients    []Number    // client ids of the written structs, sorted
+	Written    []Number    // client ids of Clients whose structs extend the state of the doc, sorted
+	RootTypes  []string    // root types of the inserted and deleted content, sorted. "" if the root type is unknown
+	DeleteSet  *DeleteSet  // deleted ranges
+}
+
+// Empty reports whether the update changes nothing, like the update a client sends in reply to SyncStep1 when it
+// has no content the server is missing.
+func (access *UpdateAccess) Empty() bool {
+	if len(access.Clients) > 0 {
+		return false
+	}
+
+	if access.DeleteSet != nil {
+		for _, deleteItems := range access.DeleteSet.Clients {
+			if len(deleteItems) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WritePolicy allows an update by returning nil, otherwise the error is sent as reason to the connection.
+type WritePolicy func(access *UpdateAccess) error
+
+// ReadOnly rejects all updates that change the doc. Empty updates are allowed, so that a read-only client can
+// finish the sync handshake.
+func ReadOnly() WritePolicy {
+	return func(access *UpdateAccess) error {
+		if access.Empty() {
+			return nil
+		}
+		return ErrReadOnly
+	}
+}
+
+// WritableRootTypes only allows updates that change the given root types.
+func WritableRootTypes(rootTypes ...string) WritePolicy {
+	writable := NewSet()
+	for _, name := range rootTypes {
+		writable.Add(name)
+	}
+
+	return func(access *UpdateAccess) error {
+		for _, name := range access.RootTypes {
+			if !writable.Has(name) {
+				return fmt.Errorf("root type %q is read-only", name)
+			}
+		}
+		return nil
+	}
+}
+
+// NewUpdateAccess decodes update to find out what it changes in doc.
+//
+// The root type of a struct is found by its parent, or by its origin if the parent is not encoded. The origin
+// may be a struct of the update itself. If the root type can't be found, e.g. because the update depends on
+// structs that doc doesn't know yet, the root type "" is reported.
+func NewUpdateAccess(doc *Doc, update []byte, conn interface{}) (access *UpdateAccess, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			access = nil
+			err = ErrInvalidData
+		}
+	}()
+
+	decoder := NewUpdateDecoderV1(update)
+	reader := NewLazyStructReader(decoder, true, true)
+
+	var items []*Item
+	clients := NewSet()
+	written := NewSet()
+	for s := reader.Curr; s != nil; s = reader.Next() {
+		client := s.GetID().Client
+		clients.Add(client)
+		if _, skip := s.(*Skip); !skip && s.GetID().Clock+s.GetLength() > GetState(doc.Store, client) {
+			// structs below the state are known to doc already, e.g. relayed structs of other clients
+			written.Add(client)
+		}
+
+		if item, ok := s.(*Item); ok {
+			items = append(items, item)
+		}
+	}
+
+	ds := ReadDeleteSet(decoder)
+	if ds == nil {
+		return nil, ErrInvalidData
+	}
+
+	resolver := newRootTypeResolver(doc, items)
+	rootTypes := NewSet()
+	for _, item := range items {
+		rootTypes.Add(resolver.resolve(item))
+	}
+
+	for client, deleteItems := range ds.Clients {
+		for _, deleteItem := range deleteItems {
+			for _, name := range resolver.deletedRootTypes(client, deleteItem) {
+				rootTypes.Add(name)
+			}
+		}
+	}
+
+	access = &UpdateAccess{
+		Conn:      conn,
+		DeleteSet: ds,
+	}
+
+	for client := range clients {
+		access.Clients = append(access.Clients, client.(Number))
+	}
+	sort.Ints(access.Clients)
+
+	for client := range written {
+		access.Written = append(access.Written, client.(Number))
+	}
+	sort.Ints(access.Written)
+
+	for name := range rootTypes {
+		access.RootTypes = append(access.RootTypes, name.(string))
+	}
+	sort.Strings(access.RootTypes)
+
+	return access, nil
+}
+
+// ApplyAuthorizedUpdate applies update of conn to doc if policy allows it, otherwise the update is dropped and
+// the error of policy is returned.
+func ApplyAuthorizedUpdate(doc *Doc, update []byte, transactionOrigin interface{}, conn interface{}, policy WritePolicy) error {
+	if policy != nil {
+		access, err := NewUpdateAccess(doc, update, conn)
+		if err != nil {
+			return err
+		}
+
+		if err = policy(access); err != nil {
+			return err
+		}
+	}
+
+	ApplyUpdate(doc, update, transactionOrigin)
+	return nil
+}
+
+// rootTypeResolver finds the root types of the items of an update that is not integrated yet.
+type rootTypeResolver struct {
+	doc      *Doc
+	roots    map[IAbstractType]string
+	resolved map[*Item]string
+	byClient map[Number][]*Item // items of the update by client, sorted by clock
+}
+
+func newRootTypeResolver(doc *Doc, items []*Item) *rootTypeResolver {
+	r := &rootTypeResolver{
+		doc:      doc,
+		roots:    make(map[IAbstractType]string),
+		resolved: make(map[*Item]string),
+		byClient: make(map[Number][]*Item),
+	}
+
+	for _, item := range items {
+		r.byClient[item.ID.Client] = append(r.byClient[item.ID.Client], item)
+	}
+
+	return r
+}
+
+func (r *rootTypeResolver) resolve(item *Item) string {
+	if name, exist := r.resolved[item]; exist {
+		return name
+	}
+
+	// mark as unknown first, so that cyclic origins can't recurse forever
+	r.resolved[item] = ""
+
+	var name string
+	switch p := item.Parent.(type) {
+	case *YString:
+		name = p.Str
+	case *ID:
+		name = r.lookup(*p)
+	default:
+		if item.Origin != nil {
+			name = r.lookup(*item.Origin)
+		} else if item.RightOrigin != nil {
+			name = r.lookup(*item.RightOrigin)
+		}
+	}
+
+	r.resolved[item] = name
+	return name
+}
+
+// lookup returns the root type of the struct id, which is either integrated in doc or part of the update.
+func (r *rootTypeResolver) lookup(id ID) string {
+	if GetState(r.doc.Store, id.Client) > id.Clock {
+		if item, ok := GetItem(r.doc.Store, id).(*Item); ok {
+			return rootTypeName(item, r.roots)
+		}
+		return ""
+	}
+
+	for _, item := range r.byClient[id.Client] {
+		if item.ID.Clock <= id.Clock && id.Clock < item.ID.Clock+item.Length {
+			return r.resolve(item)
+		}
+	}
+
+	return ""
+}
+
+// deletedRootTypes returns the root types of the items in the deleted range.
+func (r *rootTypeResolver) deletedRootTypes(client Number, deleteItem *DeleteItem) []string {
+	var names []string
+	end := deleteItem.Clock + deleteItem.Length
+	known := GetState(r.doc.Store, client)
+
+	if structs, exist := r.doc.Store.Clients[client]; exist && GetState(r.doc.Store, client) > deleteItem.Clock {
+		index, err := FindIndexSS(*structs, deleteItem.Clock)
+		for ; err == nil && index < len(*structs) && (*structs)[index].GetID().Clock < end; index++ {
+			if item, ok := (*structs)[index].(*Item); ok {
+				names = append(names, rootTypeName(item, r.roots))
+			}
+		}
+	}
+
+	for _, item := range r.byClient[client] {
+		if item.ID.Clock < end && deleteItem.Clock < item.ID.Clock+item.Length {
+			names = append(names, r.resolve(item))
+		}
+		known = Max(known, item.ID.Clock+item.Length)
+	}
+
+	if end > known {
+		// deletes structs that are unknown yet
+		names = append(names, "")
+	}
+
+	return names
+}
+
+// AllOf allows an update if all policies allow it, the policies are checked in order.
+func AllOf(policies ...WritePolicy) WritePolicy {
+	return func(access *UpdateAccess) error {
+		for _, policy := range policies {
+			if err := policy(access); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWritePolicy(t *testing.T) {
+	server := NewWSSharedDoc("doc", nil, nil)
+	server.WritePolicy = WritableRootTypes("comments")
+	server.GetText("content").Insert(0, "hello world", nil)
+	comment := NewYMap(nil)
+	server.GetArray("comments").Insert(0, ArrayAny{comment})
+
+	client := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(client, EncodeStateAsUpdate(server.Doc, nil), nil)
+
+	var updates [][]byte
+	client.On("update", NewObserverHandler(func(v ...interface{}) {
+		updates = append(updates, v[0].([]byte))
+	}))
+
+	send := func() ([][]byte, error) {
+		update := updates[len(updates)-1]
+		encoder := NewUpdateEncoderV1()
+		WriteUpdate(encoder, update)
+		return server.ReadSyncMessage(NewUpdateDecoderV1(encoder.ToUint8Array()), "conn")
+	}
+
+	// nested types are resolved by the parent
+	client.GetArray("comments").Get(0).(*YMap).Set("text", "looks good")
+	access, err := NewUpdateAccess(server.Doc, updates[len(updates)-1], "conn")
+	if err != nil {
+		t.Fatalf("decode access failed. err:%s", err.Error())
+	}
+
+	if access.Conn != "conn" || !reflect.DeepEqual(access.Clients, []Number{client.ClientID}) || !reflect.DeepEqual(access.RootTypes, []string{"comments"}) {
+		t.Errorf("expected access of conn to comments by %d, got %+v", client.ClientID, access)
+	}
+
+	if _, err := send(); err != nil {
+		t.Errorf("expected update of comments to be allowed, err:%s", err.Error())
+	}
+
+	if server.GetArray("comments").Get(0).(*YMap).Get("text") != "looks good" {
+		t.Errorf("expected update of comments to be applied")
+	}
+
+	// insertions are resolved by the origin, deletions by the deleted items
+	client.GetText("content").Insert(5, ",", nil)
+	client.GetText("content").Delete(0, 1)
+	for i := len(updates) - 2; i < len(updates); i++ {
+		access, _ := NewUpdateAccess(server.Doc, updates[i], "conn")
+		if !reflect.DeepEqual(access.RootTypes, []string{"content"}) {
+			t.Errorf("expected access to content, got %v", access.RootTypes)
+		}
+	}
+
+	replies, err := send()
+	if err == nil || len(replies) != 1 {
+		t.Fatalf("expected update of content to be rejected")
+	}
+
+	if server.GetText("content").ToString() != "hello world" {
+		t.Errorf("expected rejected update not to be applied, got %s", server.GetText("content").ToString())
+	}
+
+	decoder := NewUpdateDecoderV1(replies[0])
+	if ReadVarUint(decoder.RestDecoder) != MessageAuth {
+		t.Fatalf("expected auth message")
+	}
+
+	var reason string
+	ReadAuthMessage(decoder.RestDecoder, server.Doc, func(doc *Doc, r string) {
+		reason = r
+	})
+
+	if reason != `root type "content" is read-only` {
+		t.Errorf("expected permission denied reason, got %q", reason)
+	}
+
+	// read-only connections can't write at all
+	server.WritePolicy = ReadOnly()
+	client.GetArray("comments").Insert(1, ArrayAny{"second"})
+	if _, err := send(); err != ErrReadOnly {
+		t.Errorf("expected read-only error, got %v", err)
+	}
+
+	if server.GetArray("comments").GetLength() != 1 {
+		t.Errorf("expected read-only update not to be applied")
+	}
+
+	// the empty update of a client that has nothing to send is allowed
+	empty := EncodeStateAsUpdate(NewDoc("doc", true, DefaultGCFilter, nil, false), nil)
+	if err := ApplyAuthorizedUpdate(server.Doc, empty, nil, "conn", ReadOnly()); err != nil {
+		t.Errorf("expected empty update to be allowed, got %v", err)
+	}
+}
@@ -1,6 +1,11 @@
 package y_crdt
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -25,20 +30,153 @@ import (
 
 const OutdatedTimeout = 30 * time.Second
 
+// Clock is the time source of an Awareness or a VersionHistory, it is replaced in tests.
+type Clock interface {
+	// Now returns the current Unix time in milliseconds.
+	Now() int64
+
+	// Every calls f every interval until stop is called.
+	Every(interval time.Duration, f func()) (stop func())
+}
+
+// SystemClock calls f of Every on the goroutine of a ticker. If the data of f is used by other goroutines too, wrap
+// it in a LockedClock.
+var SystemClock Clock = systemClock{}
+
+// LockedClock calls f of Every while Locker is locked, Locker must be held by all other users of the data of f.
+type LockedClock struct {
+	Clock
+	Locker sync.Locker
+}
+
+func (c LockedClock) Every(interval time.Duration, f func()) func() {
+	return c.Clock.Every(interval, func() {
+		c.Locker.Lock()
+		defer c.Locker.Unlock()
+		f()
+	})
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() int64 {
+	return GetUnixTime()
+}
+
+func (systemClock) Every(interval time.Duration, f func()) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				f()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
 type Awareness struct {
 	*Observable
 	Doc      *Doc
 	ClientID Number
 	States   map[Number]Object
 	Meta     map[Number]Object
-	// CheckInterval *time.Timer
+	Clock    Clock
+	Limits   *AwarenessLimits // limits of the remote states, nil means no limits
+
+	stopCheckInterval func()
+}
+
+var (
+	ErrAwarenessStateTooLarge  = errors.New("awareness state too large")
+	ErrTooManyAwarenessClients = errors.New("too many awareness clients")
+)
+
+// AwarenessLimits bound the remote states that an Awareness accepts, so that a client can't fan out large states
+// to everyone. The local state is not limited.
+type AwarenessLimits struct {
+	MaxStateSize  int      // maximum length of an encoded state, 0 means no limit
+	MaxClients    int      // maximum number of clients with a state, 0 means no limit
+	AllowedFields []string // fields that are kept in a state, nil keeps all fields
+
+	// Transform modifies a state after the allowed fields are picked, e.g. to replace the user name
+	// by the name of the authenticated user.
+	Transform func(clientID Number, state Object) Object
+}
+
+// apply returns the limited state of a client, or an error if the state is rejected.
+func (l *AwarenessLimits) apply(awareness *Awareness, clientID Number, state Object, size int) (Object, error) {
+	if l.MaxStateSize > 0 && size > l.MaxStateSize {
+		return nil, ErrAwarenessStateTooLarge
+	}
+
+	if _, exist := awareness.States[clientID]; !exist && l.MaxClients > 0 && len(awareness.States) >= l.MaxClients {
+		return nil, ErrTooManyAwarenessClients
+	}
+
+	if l.AllowedFields != nil {
+		allowed := make(Object, len(l.AllowedFields))
+		for _, field := range l.AllowedFields {
+			if value, exist := state[field]; exist {
+				allowed[field] = value
+			}
+		}
+		state = allowed
+	}
+
+	if l.Transform != nil {
+		state = l.Transform(clientID, state)
+	}
+
+	return state, nil
 }
 
 func (a *Awareness) Destroy() {
+	if a.stopCheckInterval != nil {
+		a.stopCheckInterval()
+		a.stopCheckInterval = nil
+	}
+
 	a.Emit("destroy", []interface{}{a})
 	a.SetLocalState(nil)
 	a.Observable.Destroy()
-	// ClearInterval(a.CheckInterval)
+}
+
+// CheckOutdatedStates renews the local state if it is older than OutdatedTimeout/2 and removes the remote states
+// that were not updated for OutdatedTimeout. It is called every OutdatedTimeout/10 by the clock of the awareness.
+func (a *Awareness) CheckOutdatedStates() {
+	now := a.Clock.Now()
+	timeout := OutdatedTimeout.Milliseconds()
+
+	if a.GetLocalState() != nil {
+		lastUpdated, ok := a.Meta[a.ClientID]["lastUpdated"].(int64)
+		if ok && timeout/2 <= now-lastUpdated {
+			// renew local clock
+			a.SetLocalState(a.GetLocalState())
+		}
+	}
+
+	var remove []Number
+	for clientID, meta := range a.Meta {
+		lastUpdated, _ := meta["lastUpdated"].(int64)
+		_, exist := a.States[clientID]
+		if clientID != a.ClientID && timeout <= now-lastUpdated && exist {
+			remove = append(remove, clientID)
+		}
+	}
+
+	if len(remove) > 0 {
+		sort.Ints(remove)
+		RemoveAwarenessStates(a, remove, "timeout")
+	}
 }
 
 func (a *Awareness) GetLocalState() Object {
@@ -63,7 +201,7 @@ func (a *Awareness) SetLocalState(state Object) {
 
 	a.Meta[clientID] = Object{
 		"clock":       clock,
-		"lastUpdated": GetUnixTime(),
+		"lastUpdated": a.Clock.Now(),
 	}
 
 	var added []Number
@@ -78,7 +216,7 @@ func (a *Awareness) SetLocalState(state Object) {
 		// }
 	} else {
 		updated = append(updated, clientID)
-		if EqualAttrs(prevState, state) {
+		if !EqualAttrs(prevState, state) {
 			filteredUpdated = append(filteredUpdated, clientID)
 		}
 	}
@@ -107,38 +245,26 @@ func (a *Awareness) GetStates() map[Number]Object {
 	return a.States
 }
 
+// NewAwareness creates an awareness that checks the outdated states by SystemClock, i.e. on the goroutine of a
+// ticker. An awareness that is also used by other goroutines must be created by NewAwarenessWithClock with a
+// LockedClock of the lock that guards it.
 func NewAwareness(doc *Doc) *Awareness {
+	return NewAwarenessWithClock(doc, SystemClock)
+}
+
+// NewAwarenessWithClock creates an awareness that checks the outdated states every OutdatedTimeout/10 by clock,
+// until it or its doc is destroyed.
+func NewAwarenessWithClock(doc *Doc, clock Clock) *Awareness {
 	aw := &Awareness{
 		Observable: NewObservable(),
 		Doc:        doc,
 		ClientID:   doc.ClientID,
 		States:     make(map[Number]Object),
 		Meta:       make(map[Number]Object),
+		Clock:      clock,
 	}
 
-	// aw.CheckInterval = time.AfterFunc(OutdatedTimeout/10, func() {
-	// 	now := GetUnixTime()
-	//
-	// 	if aw.GetLocalState() != nil {
-	// 		lastUpdated, ok := aw.Meta[aw.ClientID]["lastUpdated"].(int64)
-	// 		if ok && int64(OutdatedTimeout/2) <= now-lastUpdated {
-	// 			aw.SetLocalState(aw.GetLocalState())
-	// 		}
-	// 	}
-	//
-	// 	var remove []Number
-	// 	for clientID, meta := range aw.Meta {
-	// 		lastUpdated := meta["lastUpdated"].(int64)
-	// 		_, existStates := aw.States[clientID]
-	// 		if clientID != aw.ClientID && int64(OutdatedTimeout) <= now-lastUpdated && existStates {
-	// 			remove = append(remove, clientID)
-	// 		}
-	// 	}
-	//
-	// 	if len(remove) > 0 {
-	// 		RemoveAwarenessStates(aw, remove, "timeout")
-	// 	}
-	// })
+	aw.stopCheckInterval = clock.Every(OutdatedTimeout/10, aw.CheckOutdatedStates)
 
 	doc.On("destroy", NewObserverHandler(func(v ...interface{}) {
 		aw.Destroy()
@@ -161,7 +287,7 @@ func RemoveAwarenessStates(awareness *Awareness, clients []Number, origin interf
 				curMeta := awareness.Meta[clientID]
 				awareness.Meta[clientID] = Object{
 					"clock":       curMeta["clock"].(Number) + 1,
-					"lastUpdated": GetUnixTime(),
+					"lastUpdated": awareness.Clock.Now(),
 				}
 			}
 			removed = append(removed, clientID)
@@ -217,21 +343,88 @@ func ModifyAwarenessUpdate(update []byte, modify func(interface{}) interface{})
 	return encoder.Bytes()
 }
 
+// AwarenessUpdateOptions configure how ApplyAwarenessUpdateWithOptions applies an awareness update.
+type AwarenessUpdateOptions struct {
+	// Silent applies the update without emitting the "change" and "update" events.
+	Silent bool
+
+	// Origin is passed to the events.
+	Origin interface{}
+
+	// Filter checks the state of a client before it is applied, size is the length of the encoded state.
+	// It may return a modified state, e.g. without unwanted fields. If it returns an error, the state of the
+	// client is not applied and the error is returned. Removed states are not filtered.
+	Filter func(clientID Number, state Object, size int) (Object, error)
+}
+
+// AwarenessChange summarizes the clients changed by an awareness update.
+type AwarenessChange struct {
+	Added   []Number
+	Updated []Number // clients whose clock was renewed
+	Changed []Number // the updated clients whose state is different
+	Removed []Number
+}
+
+type awarenessEntry struct {
+	clientID Number
+	clock    Number
+	state    Object
+	size     int
+}
+
 func ApplyAwarenessUpdate(awareness *Awareness, update []byte, origin interface{}) {
-	decoder := NewDecoder(update)
-	timestamp := GetUnixTime()
-	var added []Number
-	var updated []Number
-	var filteredUpdated []Number
-	var removed []Number
-	length := ReadVarUint(decoder)
+	_, err := ApplyAwarenessUpdateWithOptions(awareness, update, &AwarenessUpdateOptions{Origin: origin})
+	if err != nil {
+		Logf("[crdt] apply awareness update failed. err:%s", err.Error())
+	}
+}
 
-	for i := uint64(0); i < length; i++ {
-		clientID := Number(ReadVarUint(decoder))
-		clock := Number(ReadVarUint(decoder))
+// VenusApplyAwarenessUpdate this method is belong golang venus library. Apply awareness'
+// update without emit 'update' and 'change' event.
+//
+// Deprecated: use ApplyAwarenessUpdateWithOptions with Silent.
+func VenusApplyAwarenessUpdate(awareness *Awareness, update []byte) {
+	_, err := ApplyAwarenessUpdateWithOptions(awareness, update, &AwarenessUpdateOptions{Silent: true})
+	if err != nil {
+		Logf("[crdt] apply awareness update failed. err:%s", err.Error())
+	}
+}
 
-		data, _ := ReadString(decoder)
-		state := JsonObject(data)
+// ApplyAwarenessUpdateWithOptions applies an awareness update and returns the changed clients.
+//
+// A malformed update returns ErrInvalidData without applying anything. The states rejected by the limits of the
+// awareness or the filter are skipped, the other states are applied and the errors are returned together.
+func ApplyAwarenessUpdateWithOptions(awareness *Awareness, update []byte, opts *AwarenessUpdateOptions) (*AwarenessChange, error) {
+	if opts == nil {
+		opts = &AwarenessUpdateOptions{}
+	}
+
+	entries, err := readAwarenessEntries(update)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := awareness.Clock.Now()
+	change := &AwarenessChange{}
+	var errs []error
+
+	for _, entry := range entries {
+		clientID, clock, state := entry.clientID, entry.clock, entry.state
+		if state != nil && awareness.Limits != nil && clientID != awareness.ClientID {
+			state, err = awareness.Limits.apply(awareness, clientID, state, entry.size)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("client %d: %w", clientID, err))
+				continue
+			}
+		}
+
+		if state != nil && opts.Filter != nil {
+			state, err = opts.Filter(clientID, state, entry.size)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("client %d: %w", clientID, err))
+				continue
+			}
+		}
 
 		clientMeta := awareness.Meta[clientID]
 		prevState := awareness.States[clientID]
@@ -253,7 +446,7 @@ func ApplyAwarenessUpdate(awareness *Awareness, update []byte, origin interface{
 					delete(awareness.States, clientID)
 				}
 			} else {
-				awareness.States[clientID] = state.(Object)
+				awareness.States[clientID] = state
 			}
 
 			awareness.Meta[clientID] = Object{
@@ -262,83 +455,69 @@ func ApplyAwarenessUpdate(awareness *Awareness, update []byte, origin interface{
 			}
 
 			if clientMeta == nil && state != nil {
-				added = append(added, clientID)
+				change.Added = append(change.Added, clientID)
 			} else if clientMeta != nil && state == nil {
-				removed = append(removed, clientID)
+				change.Removed = append(change.Removed, clientID)
 			} else if state != nil {
 				if !EqualAttrs(state, prevState) {
-					filteredUpdated = append(filteredUpdated, clientID)
+					change.Changed = append(change.Changed, clientID)
 				}
-				updated = append(updated, clientID)
+				change.Updated = append(change.Updated, clientID)
 			}
 		}
 	}
 
-	if len(added) > 0 || len(filteredUpdated) > 0 || len(removed) > 0 {
-		awareness.Emit("change", Object{"added": added, "updated": filteredUpdated, "removed": removed}, origin)
-	}
+	if !opts.Silent {
+		if len(change.Added) > 0 || len(change.Changed) > 0 || len(change.Removed) > 0 {
+			awareness.Emit("change", Object{"added": change.Added, "updated": change.Changed, "removed": change.Removed}, opts.Origin)
+		}
 
-	if len(added) > 0 || len(updated) > 0 || len(removed) > 0 {
-		awareness.Emit("update", Object{"added": added, "updated": updated, "removed": removed}, origin)
+		if len(change.Added) > 0 || len(change.Updated) > 0 || len(change.Removed) > 0 {
+			awareness.Emit("update", Object{"added": change.Added, "updated": change.Updated, "removed": change.Removed}, opts.Origin)
+		}
 	}
+
+	return change, errors.Join(errs...)
 }
 
-// VenusApplyAwarenessUpdate this method is belong golang venus library. Apply awareness'
-// update without emit 'update' and 'change' event.
-func VenusApplyAwarenessUpdate(awareness *Awareness, update []byte) {
+// readAwarenessEntries decodes all entries of an awareness update before any of them is applied.
+func readAwarenessEntries(update []byte) ([]*awarenessEntry, error) {
 	decoder := NewDecoder(update)
-	timestamp := GetUnixTime()
-	var added []Number
-	var updated []Number
-	var filteredUpdated []Number
-	var removed []Number
-	length := ReadVarUint(decoder)
-
-	for i := uint64(0); i < length; i++ {
-		clientID := Number(ReadVarUint(decoder))
-		clock := Number(ReadVarUint(decoder))
-
-		data, _ := ReadString(decoder)
-		state := JsonObject(data)
-
-		clientMeta := awareness.Meta[clientID]
-		prevState := awareness.States[clientID]
+	length, err := readVarUint(decoder)
+	if err != nil {
+		return nil, ErrInvalidData
+	}
 
-		currClock := 0
-		if clientMeta != nil {
-			currClock = clientMeta["clock"].(Number)
+	var entries []*awarenessEntry
+	for i := uint64(0); i < length.(uint64); i++ {
+		clientID, err := readVarUint(decoder)
+		if err != nil {
+			return nil, ErrInvalidData
 		}
 
-		_, exist := awareness.States[clientID]
-		if currClock < clock || (currClock == clock && state == nil && exist) {
-			if state == nil {
-				// never let a remote client remove this local state
-				if clientID == awareness.ClientID && awareness.GetLocalState() != nil {
-					// remote client removed the local state. Do not remote state. Broadcast a message indicating
-					// that this client still exists by increasing the clock
-					clock++
-				} else {
-					delete(awareness.States, clientID)
-				}
-			} else {
-				awareness.States[clientID] = state.(Object)
-			}
+		clock, err := readVarUint(decoder)
+		if err != nil {
+			return nil, ErrInvalidData
+		}
 
-			awareness.Meta[clientID] = Object{
-				"clock":       clock,
-				"lastUpdated": timestamp,
-			}
+		data, err := ReadString(decoder)
+		if err != nil {
+			return nil, ErrInvalidData
+		}
 
-			if clientMeta == nil && state != nil {
-				added = append(added, clientID)
-			} else if clientMeta != nil && state == nil {
-				removed = append(removed, clientID)
-			} else if state != nil {
-				if !EqualAttrs(state, prevState) {
-					filteredUpdated = append(filteredUpdated, clientID)
-				}
-				updated = append(updated, clientID)
-			}
+		// "null" removes the state
+		var state Object
+		if err = json.Unmarshal([]byte(data), &state); err != nil {
+			return nil, ErrInvalidData
 		}
+
+		entries = append(entries, &awarenessEntry{
+			clientID: Number(clientID.(uint64)),
+			clock:    Number(clock.(uint64)),
+			state:    state,
+			size:     len(data),
+		})
 	}
+
+	return entries, nil
 }
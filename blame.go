@@ -0,0 +1,155 @@
+package y_crdt
+
+import (
+	"sort"
+)
+
+// BlameRun is a run of text inserted by the same user. User is "" if the client of the text isn't known to the
+// PermanentUserData, the same applies to DeletedBy.
+type BlameRun struct {
+	Text      string
+	Index     Number // position in the current text, the position where deleted text was
+	User      string
+	Deleted   bool
+	DeletedBy string
+}
+
+// Contribution counts the characters a user inserted and deleted in a doc.
+type Contribution struct {
+	User     string
+	Inserted Number
+	Deleted  Number
+}
+
+// Blame returns the runs of the current text of ytext annotated by the user who inserted them.
+func Blame(ytext *YText, pud *PermanentUserData) []BlameRun {
+	return blame(ytext, pud, false)
+}
+
+// BlameHistory returns the runs of Blame and the runs of deleted text annotated by the user who deleted them. The
+// deleted text is only known if the doc doesn't use GC.
+func BlameHistory(ytext *YText, pud *PermanentUserData) []BlameRun {
+	return blame(ytext, pud, true)
+}
+
+func blame(ytext *YText, pud *PermanentUserData, history bool) []BlameRun {
+	var runs []BlameRun
+	add := func(run BlameRun) {
+		last := len(runs) - 1
+		if last >= 0 && runs[last].User == run.User && runs[last].Deleted == run.Deleted && runs[last].DeletedBy == run.DeletedBy {
+			runs[last].Text += run.Text
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	var index Number
+	for n := ytext.Start; n != nil; n = n.Right {
+		if !n.Countable() {
+			continue
+		}
+
+		text := "\uFFFC" // embeds and types count as one character, see YText.ToDelta
+		if s, ok := n.Content.(*ContentString); ok {
+			text = s.Str
+		} else if n.Deleted() {
+			// content that was collected
+			continue
+		}
+
+		user := pud.GetUserByClientID(n.ID.Client)
+		if !n.Deleted() {
+			add(BlameRun{Text: text, Index: index, User: user})
+			index += n.Length
+			continue
+		}
+
+		if !history {
+			continue
+		}
+
+		// parts of an item may be deleted by different users
+		for offset := Number(0); offset < n.Length; {
+			deletedBy, end := deletingUser(pud, n.ID.Client, n.ID.Clock+offset, n.ID.Clock+n.Length)
+			part := StringHeader(StringTail(text, offset), end-n.ID.Clock-offset)
+			add(BlameRun{Text: part, Index: index, User: user, Deleted: true, DeletedBy: deletedBy})
+			offset = end - n.ID.Clock
+		}
+	}
+
+	return runs
+}
+
+// deletingUser returns the user who deleted the clock of client and the end of the clocks that were deleted by the
+// same user, at most end. If several users deleted the clock concurrently, the first of them by name is returned.
+func deletingUser(pud *PermanentUserData, client, clock, end Number) (string, Number) {
+	users := make([]string, 0, len(pud.Dss))
+	for user := range pud.Dss {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	deletedBy := ""
+	for _, user := range users {
+		for _, del := range pud.Dss[user].Clients[client] {
+			switch {
+			case del.Clock <= clock && clock < del.Clock+del.Length:
+				if deletedBy == "" {
+					deletedBy = user
+				}
+				end = Min(end, del.Clock+del.Length)
+			case clock < del.Clock:
+				end = Min(end, del.Clock)
+			}
+		}
+	}
+	return deletedBy, end
+}
+
+// Contributions returns the characters that each user inserted and deleted in all texts of doc, sorted by user.
+// The characters of unknown clients are counted for the user "". Deleted text is only counted if the doc doesn't
+// use GC.
+func Contributions(doc *Doc, pud *PermanentUserData) []Contribution {
+	contributions := make(map[string]*Contribution)
+	get := func(user string) *Contribution {
+		c, exist := contributions[user]
+		if !exist {
+			c = &Contribution{User: user}
+			contributions[user] = c
+		}
+		return c
+	}
+
+	for client, structs := range doc.Store.Clients {
+		for _, s := range *structs {
+			item, ok := s.(*Item)
+			if !ok {
+				continue
+			}
+
+			if _, ok := item.Content.(*ContentString); !ok {
+				continue
+			}
+
+			get(pud.GetUserByClientID(client)).Inserted += item.Length
+			if !item.Deleted() {
+				continue
+			}
+
+			for clock := item.ID.Clock; clock < item.ID.Clock+item.Length; {
+				deletedBy, end := deletingUser(pud, client, clock, item.ID.Clock+item.Length)
+				get(deletedBy).Deleted += end - clock
+				clock = end
+			}
+		}
+	}
+
+	result := make([]Contribution, 0, len(contributions))
+	for _, c := range contributions {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].User < result[j].User
+	})
+	return result
+}
@@ -0,0 +1,82 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	alice := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	bob := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	sync := func() {
+		ApplyUpdate(bob, EncodeStateAsUpdate(alice, EncodeStateVector(bob, nil, NewUpdateEncoderV1())), "sync")
+		ApplyUpdate(alice, EncodeStateAsUpdate(bob, EncodeStateVector(alice, nil, NewUpdateEncoderV1())), "sync")
+	}
+
+	keepAll := func(trans *Transaction, ds *DeleteSet) bool { return true }
+	alicePud := NewPermanentUserData(alice, nil)
+	alicePud.SetUserMapping(alice, alice.ClientID, "alice", keepAll)
+	bobPud := NewPermanentUserData(bob, nil)
+	bobPud.SetUserMapping(bob, bob.ClientID, "bob", keepAll)
+	sync()
+
+	text := alice.GetText("text")
+	text.Insert(0, "The quick fox.", nil)
+	sync()
+
+	bobText := bob.GetText("text")
+	bobText.Insert(10, "brown ", nil)
+	bobText.Delete(0, 4)
+	sync()
+
+	text.Delete(6, 9) // "brown fox" of bob and alice
+	text.Insert(6, "dog", nil)
+	sync()
+
+	if s := text.ToString(); s != "quick dog." {
+		t.Fatalf("expected synced text, got %q", s)
+	}
+
+	expected := []BlameRun{
+		{Text: "quick dog.", Index: 0, User: "alice"},
+	}
+	if runs := Blame(text, alicePud); !reflect.DeepEqual(runs, expected) {
+		t.Errorf("expected runs %v, got %v", expected, runs)
+	}
+
+	expected = []BlameRun{
+		{Text: "The ", Index: 0, User: "alice", Deleted: true, DeletedBy: "bob"},
+		{Text: "quick ", Index: 0, User: "alice"},
+		{Text: "brown ", Index: 6, User: "bob", Deleted: true, DeletedBy: "alice"},
+		{Text: "fox", Index: 6, User: "alice", Deleted: true, DeletedBy: "alice"},
+		{Text: "dog.", Index: 6, User: "alice"},
+	}
+	runs := BlameHistory(bobText, bobPud)
+	if !reflect.DeepEqual(runs, expected) {
+		t.Errorf("expected runs %v, got %v", expected, runs)
+	}
+
+	expectedContributions := []Contribution{
+		{User: "alice", Inserted: 17, Deleted: 9},
+		{User: "bob", Inserted: 6, Deleted: 4},
+	}
+	if contributions := Contributions(alice, alicePud); !reflect.DeepEqual(contributions, expectedContributions) {
+		t.Errorf("expected contributions %v, got %v", expectedContributions, contributions)
+	}
+}
+
+func TestBlameConcurrentDeletions(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	text.Insert(0, "abc", nil)
+
+	// both users deleted "b", the first user by name is reported
+	ds := NewDeleteSet()
+	AddToDeleteSet(ds, doc.ClientID, 1, 1)
+	pud := &PermanentUserData{Doc: doc, Clients: map[Number]string{doc.ClientID: "alice"}, Dss: map[string]*DeleteSet{"carol": ds, "bob": ds}}
+	for i := 0; i < 10; i++ {
+		if user, end := deletingUser(pud, doc.ClientID, 1, 3); user != "bob" || end != 2 {
+			t.Fatalf("expected deletion of bob until 2, got %q %d", user, end)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package y_crdt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangeSummary tells downstream services that a doc changed, it covers all transactions of a debounce period.
+type ChangeSummary struct {
+	GUID         string            `json:"guid"`
+	StateBefore  map[Number]Number `json:"stateBefore"`  // state vector before the first transaction
+	StateAfter   map[Number]Number `json:"stateAfter"`   // state vector after the last transaction
+	Paths        []string          `json:"paths"`        // touched paths, sorted
+	Update       []byte            `json:"update"`       // merged update v1 of the transactions
+	Transactions int               `json:"transactions"` // number of merged transactions
+}
+
+// ChangeSink delivers change summaries, e.g. to a webhook or an outbox table.
+type ChangeSink interface {
+	SendChange(summary *ChangeSummary) error
+}
+
+// ChangeSinkFunc adapts a function to a ChangeSink.
+type ChangeSinkFunc func(summary *ChangeSummary) error
+
+func (f ChangeSinkFunc) SendChange(summary *ChangeSummary) error {
+	return f(summary)
+}
+
+// HTTPChangeSink posts change summaries as json to URL.
+type HTTPChangeSink struct {
+	URL    string
+	Header http.Header  // additional request headers, e.g. for authorization
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func NewHTTPChangeSink(url string) *HTTPChangeSink {
+	return &HTTPChangeSink{URL: url, Header: make(http.Header)}
+}
+
+func (s *HTTPChangeSink) SendChange(summary *ChangeSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post change summary failed. status:%s", resp.Status)
+	}
+	return nil
+}
+
+// ChangeAggregator is an AfterApplyUpdateHook that sends one ChangeSummary per doc to Sink once the doc wasn't
+// changed for wait, but at the latest maxWait after the first change.
+//
+// The touched paths are computed from Transaction.Changed while the transaction is applied. A path is the root
+// type followed by the map keys and array indexes to the changed type, and the changed map key if any, joined
+// by ".", e.g. "content", "settings.theme" or "comments.2.text".
+type ChangeAggregator struct {
+	Sink ChangeSink
+
+	debounced *Debounced[*changeRecord]
+}
+
+type changeRecord struct {
+	before map[Number]Number
+	after  map[Number]Number
+	update []byte
+	paths  []string
+}
+
+func NewChangeAggregator(sink ChangeSink, wait, maxWait time.Duration) *ChangeAggregator {
+	a := &ChangeAggregator{Sink: sink}
+	a.debounced = NewDebounced(wait, maxWait, a.send)
+	return a
+}
+
+func (a *ChangeAggregator) AfterApplyUpdate(event *UpdateEvent) {
+	trans := event.Transaction
+	a.debounced.Add(event.Doc, &changeRecord{
+		before: trans.BeforeState,
+		after:  trans.AfterState,
+		update: event.Update,
+		paths:  ChangedPaths(trans),
+	})
+}
+
+// Flush sends the summaries of all docs with pending changes immediately, e.g. before the server shuts down.
+func (a *ChangeAggregator) Flush() {
+	a.debounced.Flush()
+}
+
+func (a *ChangeAggregator) send(doc *WSSharedDoc, records []*changeRecord) {
+	summary, err := newChangeSummary(doc.Guid, records)
+	if err == nil {
+		err = a.Sink.SendChange(summary)
+	}
+
+	if err != nil {
+		Logf("[crdt] send change summary of %s failed. err:%s", doc.Guid, err.Error())
+	}
+}
+
+func newChangeSummary(guid string, records []*changeRecord) (summary *ChangeSummary, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			summary = nil
+			err = fmt.Errorf("merge updates failed. err:%v", r)
+		}
+	}()
+
+	summary = &ChangeSummary{
+		GUID:         guid,
+		StateBefore:  records[0].before,
+		StateAfter:   records[len(records)-1].after,
+		Transactions: len(records),
+	}
+
+	var updates [][]byte
+	paths := NewSet()
+	for _, record := range records {
+		updates = append(updates, record.update)
+		for _, path := range record.paths {
+			paths.Add(path)
+		}
+	}
+
+	if len(updates) == 1 {
+		summary.Update = updates[0]
+	} else {
+		summary.Update = MergeUpdates(updates, NewUpdateDecoderV1, NewUpdateEncoderV1, true)
+	}
+
+	for path := range paths {
+		summary.Paths = append(summary.Paths, path.(string))
+	}
+	sort.Strings(summary.Paths)
+
+	return summary, nil
+}
+
+// ChangedPaths returns the sorted paths of the types and map keys changed by trans, see ChangeAggregator.
+func ChangedPaths(trans *Transaction) []string {
+	paths := NewSet()
+	for t, subs := range trans.Changed {
+		path := typePath(t.(IAbstractType))
+		if path == "" {
+			continue
+		}
+
+		if len(subs) == 0 {
+			paths.Add(path)
+		}
+
+		for sub := range subs {
+			if key, ok := sub.(string); ok && key != "" {
+				paths.Add(path + "." + key)
+			} else {
+				paths.Add(path)
+			}
+		}
+	}
+
+	var result []string
+	for path := range paths {
+		result = append(result, path.(string))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// typePath returns the path of t from its root type, "" if t is not part of a doc.
+func typePath(t IAbstractType) string {
+	root := t
+	for root.GetItem() != nil {
+		parent, ok := root.GetItem().Parent.(IAbstractType)
+		if !ok {
+			return ""
+		}
+		root = parent
+	}
+
+	name := FindRootTypeKey(root)
+	if name == "" {
+		return ""
+	}
+
+	segments := []string{name}
+	for _, segment := range GetPathTo(root, t) {
+		segments = append(segments, fmt.Sprint(segment))
+	}
+	return strings.Join(segments, ".")
+}
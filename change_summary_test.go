@@ -0,0 +1,93 @@
+package y_crdt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangeAggregator(t *testing.T) {
+	summaries := make(chan *ChangeSummary, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var summary ChangeSummary
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		summaries <- &summary
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPChangeSink(server.URL)
+	sink.Header.Set("Authorization", "secret")
+
+	doc := NewWSSharedDoc("doc", nil, nil)
+	defer doc.Destroy()
+	comments := doc.GetArray("comments")
+	comments.Insert(0, ArrayAny{NewYMap(nil)})
+
+	aggregator := NewChangeAggregator(sink, 20*time.Millisecond, time.Hour)
+	doc.AddHook(aggregator)
+
+	before := GetStateVector(doc.Store)
+	initial := EncodeStateAsUpdate(doc.Doc, nil)
+	doc.GetText("content").Insert(0, "hello", nil)
+	doc.GetMap("settings").(*YMap).Set("theme", "dark")
+	comments.Get(0).(*YMap).Set("text", "nice")
+
+	var summary *ChangeSummary
+	select {
+	case summary = <-summaries:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected change summary")
+	}
+
+	if summary.GUID != doc.Guid || summary.Transactions != 3 {
+		t.Errorf("expected summary of 3 transactions of %s, got %+v", doc.Guid, summary)
+	}
+
+	expectedPaths := []string{"comments.0.text", "content", "settings.theme"}
+	if !reflect.DeepEqual(summary.Paths, expectedPaths) {
+		t.Errorf("expected paths %v, got %v", expectedPaths, summary.Paths)
+	}
+
+	if !reflect.DeepEqual(summary.StateBefore, before) || !reflect.DeepEqual(summary.StateAfter, GetStateVector(doc.Store)) {
+		t.Errorf("expected state vectors %v and %v, got %v and %v", before, GetStateVector(doc.Store), summary.StateBefore, summary.StateAfter)
+	}
+
+	// the merged update brings a doc from the state before to the state after
+	partial := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(partial, initial, nil)
+	ApplyUpdate(partial, summary.Update, nil)
+	if partial.GetText("content").ToString() != "hello" || partial.GetMap("settings").(*YMap).Get("theme") != "dark" {
+		t.Errorf("expected merged update to hold the changes")
+	}
+
+	// Flush sends the pending changes immediately
+	doc.GetText("content").Delete(0, 1)
+	aggregator.Flush()
+	if summary = <-summaries; !reflect.DeepEqual(summary.Paths, []string{"content"}) || summary.Transactions != 1 {
+		t.Errorf("expected flushed summary of content, got %+v", summary)
+	}
+}
+
+func TestHTTPChangeSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewHTTPChangeSink(server.URL).SendChange(&ChangeSummary{GUID: "doc"}); err == nil {
+		t.Errorf("expected error of failed request")
+	}
+}
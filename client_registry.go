@@ -0,0 +1,123 @@
+package y_crdt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnauthenticated rejects the updates of connections without a user.
+var ErrUnauthenticated = errors.New("unauthenticated connection")
+
+// ClientRegistry binds client ids to the authenticated user whose connection used them first, so that a
+// connection can't write structs in the name of another user. A client id is owned forever, because its
+// structs stay in the history of the document.
+//
+// A registry can be shared by the docs of a server, it is safe for concurrent use.
+type ClientRegistry struct {
+	mutex  sync.RWMutex
+	owners map[Number]string
+}
+
+func NewClientRegistry() *ClientRegistry {
+	return &ClientRegistry{
+		owners: make(map[Number]string),
+	}
+}
+
+// Claim binds clients to user. It fails without binding any client, if one of them is owned by another user.
+func (r *ClientRegistry) Claim(user string, clients []Number) error {
+	if user == "" {
+		return ErrUnauthenticated
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, client := range clients {
+		if owner, exist := r.owners[client]; exist && owner != user {
+			return fmt.Errorf("client id %d is owned by another user", client)
+		}
+	}
+
+	for _, client := range clients {
+		r.owners[client] = user
+	}
+
+	return nil
+}
+
+// Restore binds the client ids of a mapping that was persisted by Mapping, or the Clients of a PermanentUserData,
+// e.g. when a server restarts. It fails without binding any client, if one of them is owned by another user.
+func (r *ClientRegistry) Restore(mapping map[Number]string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for client, user := range mapping {
+		if owner, exist := r.owners[client]; exist && owner != user {
+			return fmt.Errorf("client id %d is owned by another user", client)
+		}
+	}
+
+	for client, user := range mapping {
+		r.owners[client] = user
+	}
+
+	return nil
+}
+
+// Owner returns the user that owns client.
+func (r *ClientRegistry) Owner(client Number) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	owner, exist := r.owners[client]
+	return owner, exist
+}
+
+// Mapping returns a copy of the client ids and their owners.
+func (r *ClientRegistry) Mapping() map[Number]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	mapping := make(map[Number]string, len(r.owners))
+	for client, owner := range r.owners {
+		mapping[client] = owner
+	}
+
+	return mapping
+}
+
+// WritePolicy rejects updates that write new structs of client ids owned by another user, and claims the unowned
+// client ids that get new structs for the user of the connection. userOf returns the authenticated user of a
+// connection, or "".
+//
+// Structs below the state of the doc are allowed whoever owns them, because a connection may relay the structs of
+// other users. Restore the registry before the doc is shared, so that the client ids of its history are owned by
+// their users instead of by the first connection that writes them.
+//
+// Combine it with other policies by AllOf and put it last, so that an update rejected by another policy
+// doesn't claim client ids.
+func (r *ClientRegistry) WritePolicy(userOf func(conn interface{}) string) WritePolicy {
+	return func(access *UpdateAccess) error {
+		return r.Claim(userOf(access.Conn), access.Written)
+	}
+}
+
+// FillPermanentUserData adds the client ids that pud doesn't know yet to their owners, so that the users of
+// the document are recorded by the server instead of by the clients.
+func (r *ClientRegistry) FillPermanentUserData(pud *PermanentUserData) {
+	mapping := r.Mapping()
+	clients := make([]Number, 0, len(mapping))
+	for client := range mapping {
+		if _, exist := pud.Clients[client]; !exist {
+			clients = append(clients, client)
+		}
+	}
+	sort.Ints(clients)
+
+	for _, client := range clients {
+		pud.AddClientID(client, mapping[client])
+	}
+}
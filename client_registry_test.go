@@ -0,0 +1,158 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientRegistry(t *testing.T) {
+	registry := NewClientRegistry()
+	server := NewWSSharedDoc("doc", nil, nil)
+	server.WritePolicy = AllOf(WritableRootTypes("text"), registry.WritePolicy(func(conn interface{}) string {
+		return conn.(string)
+	}))
+
+	send := func(doc *Doc, conn string) error {
+		encoder := NewUpdateEncoderV1()
+		WriteUpdate(encoder, EncodeStateAsUpdate(doc, EncodeStateVector(server.Doc, nil, NewUpdateEncoderV1())))
+		_, err := server.ReadSyncMessage(NewUpdateDecoderV1(encoder.ToUint8Array()), conn)
+		return err
+	}
+
+	alice := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	alice.GetText("text").Insert(0, "alice", nil)
+	if err := send(alice, "alice"); err != nil {
+		t.Fatalf("expected update of alice to be allowed, err:%s", err.Error())
+	}
+
+	if owner, _ := registry.Owner(alice.ClientID); owner != "alice" {
+		t.Errorf("expected client %d to be owned by alice, got %s", alice.ClientID, owner)
+	}
+
+	// rejected updates don't claim client ids
+	mallory := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	mallory.GetMap("map").(*YMap).Set("key", "value")
+	if err := send(mallory, "mallory"); err == nil {
+		t.Errorf("expected update of map to be rejected")
+	}
+
+	if _, exist := registry.Owner(mallory.ClientID); exist {
+		t.Errorf("expected rejected update not to claim client %d", mallory.ClientID)
+	}
+
+	spoofed := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(spoofed, EncodeStateAsUpdate(server.Doc, nil), nil)
+	spoofed.ClientID = alice.ClientID
+	spoofed.GetText("text").Insert(0, "mallory ", nil)
+	if err := send(spoofed, "mallory"); err == nil {
+		t.Errorf("expected update with client id of alice to be rejected")
+	}
+
+	if server.GetText("text").ToString() != "alice" {
+		t.Errorf("expected spoofed update not to be applied, got %s", server.GetText("text").ToString())
+	}
+
+	anonymous := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	anonymous.GetText("text").Insert(0, "anonymous", nil)
+	if err := send(anonymous, ""); err != ErrUnauthenticated {
+		t.Errorf("expected unauthenticated error, got %v", err)
+	}
+
+	if !reflect.DeepEqual(registry.Mapping(), map[Number]string{alice.ClientID: "alice"}) {
+		t.Errorf("expected mapping of alice, got %v", registry.Mapping())
+	}
+
+	// the server records the users in the document
+	registry.FillPermanentUserData(NewPermanentUserData(server.Doc, nil))
+
+	peer := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(peer, EncodeStateAsUpdate(server.Doc, nil), nil)
+	if user := NewPermanentUserData(peer, nil).GetUserByClientID(alice.ClientID); user != "alice" {
+		t.Errorf("expected client %d to belong to alice, got %s", alice.ClientID, user)
+	}
+}
+
+func TestClientRegistryRelay(t *testing.T) {
+	registry := NewClientRegistry()
+	server := NewWSSharedDoc("doc", nil, nil)
+	server.WritePolicy = registry.WritePolicy(func(conn interface{}) string {
+		return conn.(string)
+	})
+
+	// history of carol that was written before the registry was used
+	carol := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	carol.GetText("text").Insert(0, "carol", nil)
+	ApplyUpdate(server.Doc, EncodeStateAsUpdate(carol, nil), nil)
+
+	// bob sends his whole state, it relays the structs of carol
+	bob := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(bob, EncodeStateAsUpdate(server.Doc, nil), nil)
+	bob.GetText("text").Insert(0, "bob ", nil)
+	encoder := NewUpdateEncoderV1()
+	WriteUpdate(encoder, EncodeStateAsUpdate(bob, nil))
+	if _, err := server.ReadSyncMessage(NewUpdateDecoderV1(encoder.ToUint8Array()), "bob"); err != nil {
+		t.Fatalf("expected update of bob to be allowed, err:%s", err.Error())
+	}
+
+	if _, exist := registry.Owner(carol.ClientID); exist {
+		t.Errorf("expected client %d of carol not to be claimed by bob", carol.ClientID)
+	}
+
+	if !reflect.DeepEqual(registry.Mapping(), map[Number]string{bob.ClientID: "bob"}) {
+		t.Errorf("expected mapping of bob, got %v", registry.Mapping())
+	}
+
+	// new structs of the unowned client id of carol claim it for the sender
+	send := func(doc *Doc, conn string) error {
+		encoder := NewUpdateEncoderV1()
+		WriteUpdate(encoder, EncodeStateAsUpdate(doc, EncodeStateVector(server.Doc, nil, NewUpdateEncoderV1())))
+		_, err := server.ReadSyncMessage(NewUpdateDecoderV1(encoder.ToUint8Array()), conn)
+		return err
+	}
+
+	spoofed := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(spoofed, EncodeStateAsUpdate(server.Doc, nil), nil)
+	spoofed.ClientID = carol.ClientID
+	spoofed.GetText("text").Insert(0, "mallory ", nil)
+	if err := send(spoofed, "mallory"); err != nil {
+		t.Fatalf("expected update of mallory to be allowed, err:%s", err.Error())
+	}
+
+	if owner, _ := registry.Owner(carol.ClientID); owner != "mallory" {
+		t.Errorf("expected client %d to be claimed by mallory, got %s", carol.ClientID, owner)
+	}
+
+	spoofed.GetText("text").Insert(0, "eve ", nil)
+	if err := send(spoofed, "eve"); err == nil {
+		t.Errorf("expected new structs of a client id owned by mallory to be rejected")
+	}
+}
+
+func TestClientRegistryRestore(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	pud := NewPermanentUserData(doc, nil)
+	pud.SetUserMapping(doc, 1, "alice", nil)
+	pud.SetUserMapping(doc, 2, "bob", nil)
+
+	registry := NewClientRegistry()
+	if err := registry.Restore(pud.Clients); err != nil {
+		t.Fatalf("restore failed. err:%s", err.Error())
+	}
+
+	if !reflect.DeepEqual(registry.Mapping(), map[Number]string{1: "alice", 2: "bob"}) {
+		t.Errorf("expected mapping of the permanent user data, got %v", registry.Mapping())
+	}
+
+	// a persisted mapping that conflicts isn't restored
+	if err := registry.Restore(map[Number]string{2: "mallory", 3: "mallory"}); err == nil {
+		t.Errorf("expected conflicting mapping to be rejected")
+	}
+
+	if _, exist := registry.Owner(3); exist {
+		t.Errorf("expected conflicting mapping not to be restored")
+	}
+
+	if err := registry.Claim("mallory", []Number{1}); err == nil {
+		t.Errorf("expected restored client id to be owned")
+	}
+}
@@ -0,0 +1,320 @@
+// Command ycrdt inspects and manipulates stored y-crdt updates.
+//
+// Usage:
+//
+//	ycrdt inspect [update]              dump structs and the delete set as json
+//	ycrdt merge update1 update2 ...     merge several updates into one
+//	ycrdt diff -sv file [update]        compute the update that is missing for a state vector
+//	ycrdt sv [update]                   print the state vector of an update as json
+//	ycrdt json [update]                 apply the update to a fresh doc and print its content
+//	ycrdt convert -to v1|v2 [update]    convert an update between v1 and the v2 layout of this package
+//	ycrdt obfuscate [update]            replace private content by placeholders
+//
+// An update is read from stdin when the file is omitted or is "-", so that the
+// commands can be used in pipelines. Binary results are written to stdout.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	y "github.com/skyterra/y-crdt"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"inspect":   {"inspect [update]", runInspect},
+	"merge":     {"merge update1 update2 ...", runMerge},
+	"diff":      {"diff -sv file [update]", runDiff},
+	"sv":        {"sv [update]", runSv},
+	"json":      {"json [update]", runJson},
+	"convert":   {"convert -to v1|v2 [update]", runConvert},
+	"obfuscate": {"obfuscate [update]", runObfuscate},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, exist := commands[os.Args[1]]
+	if !exist {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "ycrdt %s: %s\n", os.Args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, name := range []string{"inspect", "merge", "diff", "sv", "json", "convert", "obfuscate"} {
+		fmt.Fprintf(os.Stderr, "  ycrdt %s\n", commands[name].usage)
+	}
+}
+
+func runInspect(args []string, stdout io.Writer) error {
+	update, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := y.DecodeUpdate(update)
+	if err != nil {
+		return err
+	}
+
+	return writeJson(stdout, decoded)
+}
+
+func runMerge(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	updates := make([][]uint8, 0, len(args))
+	for _, name := range args {
+		update, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, update)
+	}
+
+	merged, err := mergeUpdates(updates)
+	if err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(merged)
+	return err
+}
+
+func runDiff(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	svFile := flags.String("sv", "", "file of the encoded state vector")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *svFile == "" {
+		return errors.New("missing -sv")
+	}
+
+	sv, err := readFile(*svFile)
+	if err != nil {
+		return err
+	}
+
+	update, err := readUpdate(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	var diff []uint8
+	if err := recoverInvalid(func() { diff = y.DiffUpdate(update, sv) }); err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(diff)
+	return err
+}
+
+func runSv(args []string, stdout io.Writer) error {
+	update, err := readUpdate(args)
+	if err != nil {
+		return err
+	}
+
+	var sv map[y.Number]y.Number
+	if err := recoverInvalid(func() { sv = y.DecodeStateVector(y.EncodeStateVectorFromUpdate(update)) }); err != nil {
+		return err
+	}
+
+	return writeJson(stdout, sv)
+}
+
+func runJson(args []string, stdout io.Writer) error {
+	update, err := readUpdate(args)
+	if err != nil {
+		return err
+	}
+
+	doc := y.NewDoc("ycrdt", false, y.DefaultGCFilter, nil, false)
+	var content interface{}
+	err = recoverInvalid(func() {
+		y.ApplyUpdate(doc, update, nil)
+		defineRootTypes(doc)
+		content = doc.ToJson()
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeJson(stdout, content)
+}
+
+// runConvert converts between v1 and the v2 layout of UpdateEncoderV2. V2 updates of Yjs use a column encoding
+// that this package doesn't implement yet, converting them is refused.
+func runConvert(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := flags.String("to", "v1", "target format, v1 or v2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	update, err := readInput(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	var converted []uint8
+	switch *to {
+	case "v1":
+		converted, err = y.ConvertUpdateFormatV2ToV1(update)
+	case "v2":
+		if _, err = y.DecodeUpdate(update); err == nil {
+			converted, err = y.ConvertUpdateFormatV1ToV2(update)
+		}
+	default:
+		err = fmt.Errorf("unknown format %s", *to)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(converted)
+	return err
+}
+
+func runObfuscate(args []string, stdout io.Writer) error {
+	update, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	obfuscated, err := y.ObfuscateUpdate(update, y.DefaultObfuscatorOptions())
+	if err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(obfuscated)
+	return err
+}
+
+// mergeUpdates merges the updates and reports invalid data as an error.
+func mergeUpdates(updates [][]uint8) (merged []uint8, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("merge updates failed. err:%v", r)
+		}
+	}()
+
+	return y.MergeUpdates(updates, y.NewUpdateDecoderV1, y.NewUpdateEncoderV1, true), nil
+}
+
+// recoverInvalid calls f and reports a panic caused by invalid data as an error.
+func recoverInvalid(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid update. err:%v", r)
+		}
+	}()
+
+	f()
+	return nil
+}
+
+// defineRootTypes replaces the untyped root types of doc by the type guessed from their content,
+// otherwise they are printed as null.
+func defineRootTypes(doc *y.Doc) {
+	for name, t := range doc.Share {
+		if !y.IsSameType(t, y.NewAbstractType()) {
+			continue
+		}
+
+		switch guessRootType(t) {
+		case y.YMapRefID:
+			doc.GetMap(name)
+		case y.YTextRefID:
+			doc.GetText(name)
+		case y.YXmlFragmentRefID:
+			doc.GetXmlFragment(name)
+		default:
+			doc.GetArray(name)
+		}
+	}
+}
+
+func guessRootType(t y.IAbstractType) int {
+	if t.StartItem() == nil && len(t.GetMap()) > 0 {
+		return y.YMapRefID
+	}
+
+	for item := t.StartItem(); item != nil; item = item.Right {
+		switch c := item.Content.(type) {
+		case *y.ContentString, *y.ContentFormat, *y.ContentEmbed:
+			return y.YTextRefID
+		case *y.ContentType:
+			switch c.Type.(type) {
+			case *y.YXmlElement, *y.YXmlText, *y.YXmlHook:
+				return y.YXmlFragmentRefID
+			}
+		}
+	}
+
+	return y.YArrayRefID
+}
+
+// readUpdate reads an update like readInput and reports a corrupt update as an error, some functions of the
+// package only log invalid data.
+func readUpdate(args []string) ([]uint8, error) {
+	update, err := readInput(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := y.DecodeUpdate(update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+func readInput(args []string) ([]uint8, error) {
+	if len(args) > 1 {
+		return nil, errors.New("too many arguments")
+	}
+
+	if len(args) == 0 {
+		return readFile("-")
+	}
+
+	return readFile(args[0])
+}
+
+func readFile(name string) ([]uint8, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(name)
+}
+
+func writeJson(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	y "github.com/skyterra/y-crdt"
+)
+
+// writeUpdates writes the update of a doc with a text and the update of a later change, returns their files and
+// the file of the state vector of the first update.
+func writeUpdates(t *testing.T) (first, second, sv string) {
+	doc := y.NewDoc("doc", false, y.DefaultGCFilter, nil, false)
+	doc.ClientID = 1
+	doc.GetText("text").Insert(0, "hello", nil)
+	update1 := y.EncodeStateAsUpdate(doc, nil)
+	state := y.EncodeStateVector(doc, nil, y.NewUpdateEncoderV1())
+	doc.GetText("text").Insert(5, " world", nil)
+	update2 := y.EncodeStateAsUpdate(doc, state)
+
+	dir := t.TempDir()
+	first, second, sv = filepath.Join(dir, "1.bin"), filepath.Join(dir, "2.bin"), filepath.Join(dir, "sv.bin")
+	for name, data := range map[string][]byte{first: update1, second: update2, sv: state} {
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return first, second, sv
+}
+
+func writeCorrupt(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "corrupt.bin")
+	if err := os.WriteFile(name, []byte{1, 5, 1, 200, 7, 3}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func run(name string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := commands[name].run(args, &stdout)
+	return stdout.Bytes(), err
+}
+
+func textOf(t *testing.T, update []byte) string {
+	doc := y.NewDoc("doc", false, y.DefaultGCFilter, nil, false)
+	y.ApplyUpdate(doc, update, nil)
+	return doc.GetText("text").ToString()
+}
+
+func TestInspect(t *testing.T) {
+	first, _, _ := writeUpdates(t)
+	out, err := run("inspect", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded y.DecodedUpdate
+	if err := json.Unmarshal(out, &decoded); err != nil || len(decoded.Clients) != 1 {
+		t.Errorf("expected decoded update of one client, got %s %v", out, err)
+	}
+
+	if _, err := run("inspect", writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	first, second, _ := writeUpdates(t)
+	out, err := run("merge", first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := textOf(t, out); s != "hello world" {
+		t.Errorf("expected merged text, got %q", s)
+	}
+
+	if _, err := run("merge", first, writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	first, second, sv := writeUpdates(t)
+	merged, err := run("merge", first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := filepath.Join(t.TempDir(), "all.bin")
+	if err := os.WriteFile(all, merged, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run("diff", "-sv", sv, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update1, _ := os.ReadFile(first)
+	if s := textOf(t, y.MergeUpdates([][]byte{update1, out}, y.NewUpdateDecoderV1, y.NewUpdateEncoderV1, true)); s != "hello world" {
+		t.Errorf("expected diff to add the missing change, got %q", s)
+	}
+
+	if _, err := run("diff", all); err == nil {
+		t.Errorf("expected error for a missing state vector")
+	}
+
+	if _, err := run("diff", "-sv", sv, writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+}
+
+func TestSv(t *testing.T) {
+	first, _, _ := writeUpdates(t)
+	out, err := run("sv", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(out), `"1": 5`) {
+		t.Errorf("expected state of client 1, got %s", out)
+	}
+
+	if _, err := run("sv", writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+}
+
+func TestJson(t *testing.T) {
+	first, _, _ := writeUpdates(t)
+	out, err := run("json", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content map[string]interface{}
+	if err := json.Unmarshal(out, &content); err != nil || content["text"] != "hello" {
+		t.Errorf("expected content of the doc, got %s %v", out, err)
+	}
+
+	if _, err := run("json", writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+}
+
+func TestObfuscate(t *testing.T) {
+	first, _, _ := writeUpdates(t)
+	out, err := run("obfuscate", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := textOf(t, out); len(s) != 5 || s == "hello" {
+		t.Errorf("expected obfuscated text of the same length, got %q", s)
+	}
+
+	if _, err := run("obfuscate", writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	first, _, _ := writeUpdates(t)
+	v2, err := run("convert", "-to", "v2", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "v2.bin")
+	if err := os.WriteFile(name, v2, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := run("convert", "-to", "v1", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := textOf(t, v1); s != "hello" {
+		t.Errorf("expected converted text, got %q", s)
+	}
+
+	if _, err := run("convert", "-to", "v3", first); err == nil {
+		t.Errorf("expected error for an unknown format")
+	}
+
+	if _, err := run("convert", "-to", "v2", writeCorrupt(t)); err == nil {
+		t.Errorf("expected error for a corrupt update")
+	}
+
+	// a v1 update is no v2 update
+	if _, err := run("convert", "-to", "v1", first); err == nil {
+		t.Errorf("expected error for a v1 update")
+	}
+}
+
+func TestUnknownInput(t *testing.T) {
+	if _, err := run("sv", "a", "b"); err == nil {
+		t.Errorf("expected error for too many arguments")
+	}
+}
@@ -1,13 +1,10 @@
 package y_crdt
 
-import (
-	"github.com/mitchellh/copystructure"
-)
-
 const (
-	OptKeyGC       = "gc"
-	OptKeyAutoLoad = "autoLoad"
-	OptKeyMeta     = "meta"
+	OptKeyGC         = "gc"
+	OptKeyAutoLoad   = "autoLoad"
+	OptKeyMeta       = "meta"
+	OptKeyShouldLoad = "shouldLoad"
 )
 
 type ContentDoc struct {
@@ -28,12 +25,7 @@ func (c *ContentDoc) IsCountable() bool {
 }
 
 func (c *ContentDoc) Copy() IAbstractContent {
-	doc, err := copystructure.Copy(c.Doc)
-	if err != nil {
-		return nil
-	}
-
-	return NewContentDoc(doc.(*Doc))
+	return NewContentDoc(NewDocFromOpts(c.Doc.Guid, c.Opts))
 }
 
 func (c *ContentDoc) Splice(offset Number) IAbstractContent {
@@ -44,12 +36,22 @@ func (c *ContentDoc) MergeWith(right IAbstractContent) bool {
 	return false
 }
 
+// Integrate links the subdoc to item, the parent doc registers it when the transaction is cleaned up.
 func (c *ContentDoc) Integrate(trans *Transaction, item *Item) {
-	// TODO
+	c.Doc.Item = item
+	trans.SubdocsAdded.Add(c.Doc)
+	if c.Doc.ShouldLoad {
+		trans.SubdocsLoaded.Add(c.Doc)
+	}
 }
 
+// Delete removes the subdoc from the parent doc, it is destroyed when the transaction is cleaned up.
 func (c *ContentDoc) Delete(trans *Transaction) {
-	// TODO
+	if trans.SubdocsAdded.Has(c.Doc) {
+		trans.SubdocsAdded.Delete(c.Doc)
+	} else {
+		trans.SubdocsRemoved.Add(c.Doc)
+	}
 }
 
 func (c *ContentDoc) GC(store *StructStore) {
@@ -71,6 +73,10 @@ func (c *ContentDoc) GetRef() uint8 {
 }
 
 func NewContentDoc(doc *Doc) *ContentDoc {
+	if doc.Item != nil {
+		Logf("[crdt] This document was already integrated as a sub-document. You should create a second instance instead with the same guid.")
+	}
+
 	c := &ContentDoc{
 		Doc:  doc,
 		Opts: NewObject(),
@@ -102,18 +108,26 @@ func ReadContentDoc(decoder *UpdateDecoderV1) (IAbstractContent, error) {
 		return nil, err
 	}
 
-	opts := any.(Object)
+	opts, ok := any.(Object)
+	if !ok {
+		return nil, ErrInvalidData
+	}
 
+	return NewContentDoc(NewDocFromOpts(guid, opts)), nil
+}
+
+// NewDocFromOpts creates the subdoc guid with the options of its ContentDoc. A subdoc is only loaded if
+// autoLoad or shouldLoad is set.
+func NewDocFromOpts(guid string, opts Object) *Doc {
 	gc, ok := opts[OptKeyGC].(bool)
 	if !ok {
 		gc = true // 不存在gc参数，使用默认参数
 	}
 
-	autoLoad, ok := opts[OptKeyAutoLoad].(bool)
-	if !ok {
-		autoLoad = false // 不存在autoLoad参数，使用默认参数
-	}
+	autoLoad, _ := opts[OptKeyAutoLoad].(bool)
+	shouldLoad, _ := opts[OptKeyShouldLoad].(bool)
 
 	doc := NewDoc(guid, gc, DefaultGCFilter, opts[OptKeyMeta], autoLoad)
-	return NewContentDoc(doc), nil
+	doc.ShouldLoad = shouldLoad || autoLoad
+	return doc
 }
@@ -2,8 +2,6 @@ package y_crdt
 
 import (
 	"fmt"
-
-	"github.com/mitchellh/copystructure"
 )
 
 var typeRefs = []func(decoder *UpdateDecoderV1) (IAbstractType, error){
@@ -32,13 +30,9 @@ func (c *ContentType) IsCountable() bool {
 	return true
 }
 
+// Copy creates an empty type of the same kind, the children are redone separately.
 func (c *ContentType) Copy() IAbstractContent {
-	cpType, err := copystructure.Copy(c.Type)
-	if err != nil {
-		return nil
-	}
-
-	return NewContentType(cpType.(IAbstractType))
+	return NewContentType(c.Type.Copy())
 }
 
 func (c *ContentType) Splice(offset Number) IAbstractContent {
@@ -53,27 +47,43 @@ func (c *ContentType) Integrate(trans *Transaction, item *Item) {
 	c.Type.Integrate(trans.Doc, item)
 }
 
+// Delete deletes all children of the type, so that they are garbage collected with it.
 func (c *ContentType) Delete(trans *Transaction) {
-	// TODO
+	for item := c.Type.StartItem(); item != nil; item = item.Right {
+		deleteChild(trans, item)
+	}
 
-	// item := c.Type.StartItem()
-	// for item != nil {
-	// 	if !item.Deleted() {
-	// 		item.Delete(trans)
-	// 	} else {
-	// 		// Whis will be gc'd later and we want to merge it if possible
-	// 		// We try to merge all deleted items after each transaction,
-	// 		// but we have no knowledge about that this needs to be merged
-	// 		// since it is not in transaction.ds. Hence we add it to transaction._mergeStructs
-	// 		//trans._mergeStructs.push(item)
-	// 	}
-	// 	item = item.Right
-	// }
+	for _, item := range c.Type.GetMap() {
+		deleteChild(trans, item)
+	}
 
+	delete(trans.Changed, c.Type)
 }
 
+// GC replaces all children of the type, including the overwritten map entries, with GC structs.
 func (c *ContentType) GC(store *StructStore) {
-	// TODO
+	for item := c.Type.StartItem(); item != nil; item = item.Right {
+		item.GC(store, true)
+	}
+	c.Type.SetStartItem(nil)
+
+	for _, item := range c.Type.GetMap() {
+		for ; item != nil; item = item.Left {
+			item.GC(store, true)
+		}
+	}
+	c.Type.SetMap(make(map[string]*Item))
+}
+
+func deleteChild(trans *Transaction, item *Item) {
+	if !item.Deleted() {
+		item.Delete(trans)
+	} else if item.ID.Clock < trans.BeforeState[item.ID.Client] {
+		// This will be gc'd later and we want to merge it if possible. We try to merge all deleted items after
+		// each transaction, but we have no knowledge about that this needs to be merged since it is not in
+		// trans.DeleteSet. Hence we add it to trans.MergeStructs.
+		trans.MergeStructs = append(trans.MergeStructs, item)
+	}
 }
 
 func (c *ContentType) Write(encoder *UpdateEncoderV1, offset Number) error {
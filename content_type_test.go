@@ -0,0 +1,103 @@
+package y_crdt
+
+import (
+	"testing"
+)
+
+// countItems counts the items of doc that still hold content.
+func countItems(doc *Doc) (items int, deleted int) {
+	for _, structs := range doc.Store.Clients {
+		for _, s := range *structs {
+			if item, ok := s.(*Item); ok {
+				if _, ok := item.Content.(*ContentDeleted); ok {
+					deleted++
+				} else {
+					items++
+				}
+			}
+		}
+	}
+	return items, deleted
+}
+
+func fillNestedTypes(doc *Doc) *YArray {
+	nested := NewYMap(nil)
+	doc.GetMap("root").(*YMap).Set("nested", nested)
+
+	list := NewYArray()
+	nested.Set("list", list)
+	nested.Set("title", "draft")
+	nested.Set("title", "final")
+
+	for i := 0; i < 100; i++ {
+		list.Insert(list.GetLength(), ArrayAny{i, NewYText("text")})
+	}
+	return list
+}
+
+func TestNestedTypeGC(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	list := fillNestedTypes(doc)
+
+	remote := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(remote, EncodeStateAsUpdate(doc, nil), nil)
+	var update []byte
+	doc.On("update", NewObserverHandler(func(v ...interface{}) {
+		update = v[0].([]byte)
+	}))
+
+	observed := false
+	list.Observe(func(e interface{}, trans interface{}) {
+		observed = true
+	})
+
+	before := EstimateDocMemory(doc)
+	doc.GetMap("root").(*YMap).Delete("nested")
+	if observed {
+		t.Errorf("expected observer of a deleted type not to be called")
+	}
+
+	// only the deleted root entry is kept, its children are replaced by merged GC structs
+	if items, deleted := countItems(doc); items != 0 || deleted != 1 {
+		t.Errorf("expected children to be garbage collected, got %d items and %d deleted items", items, deleted)
+	}
+
+	if structs := len(*doc.Store.Clients[doc.ClientID]); structs > 3 {
+		t.Errorf("expected GC structs to be merged, got %d structs", structs)
+	}
+
+	if after := EstimateDocMemory(doc); after*10 > before {
+		t.Errorf("expected memory to be released, got %d of %d", after, before)
+	}
+
+	// the children are collected when the deletion is received as well
+	ApplyUpdate(remote, update, nil)
+	if items, _ := countItems(remote); items != 0 {
+		t.Errorf("expected remote children to be garbage collected, got %d items", items)
+	}
+
+	if remote.GetMap("root").(*YMap).Has("nested") {
+		t.Errorf("expected nested map to be deleted")
+	}
+}
+
+func TestNestedTypeDeleteWithoutGC(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	list := fillNestedTypes(doc)
+	first := list.StartItem()
+
+	doc.GetMap("root").(*YMap).Delete("nested")
+	if !first.Deleted() {
+		t.Errorf("expected children to be deleted")
+	}
+
+	// the deleted content is kept, e.g. for snapshots
+	if _, ok := first.Content.(*ContentAny); !ok {
+		t.Errorf("expected content of children to be kept, got %T", first.Content)
+	}
+
+	ds := NewDeleteSetFromStructStore(doc.Store)
+	if !IsDeleted(ds, &first.ID) {
+		t.Errorf("expected children in the delete set")
+	}
+}
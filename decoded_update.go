@@ -0,0 +1,251 @@
+package y_crdt
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// DecodedPreviewLength is the maximum number of characters kept in the value
+// preview of a decoded string content.
+const DecodedPreviewLength = 64
+
+// DecodedID is the JSON friendly form of an ID.
+type DecodedID struct {
+	Client Number `json:"client"`
+	Clock  Number `json:"clock"`
+}
+
+// DecodedStruct is a human-readable view of a struct (Item, GC or Skip) in an update.
+type DecodedStruct struct {
+	Kind        string      `json:"kind"` // Item | GC | Skip
+	ID          DecodedID   `json:"id"`
+	Length      Number      `json:"length"`
+	Origin      *DecodedID  `json:"origin,omitempty"`
+	RightOrigin *DecodedID  `json:"rightOrigin,omitempty"`
+	Parent      *DecodedID  `json:"parent,omitempty"`     // parent is the item of a nested type
+	ParentYKey  string      `json:"parentYKey,omitempty"` // parent is the root type doc.Share[ParentYKey]
+	ParentSub   string      `json:"parentSub,omitempty"`
+	ContentType string      `json:"contentType,omitempty"`
+	Preview     interface{} `json:"preview,omitempty"`
+}
+
+// DecodedClientStructs holds the structs of one client in the order they were encoded.
+type DecodedClientStructs struct {
+	Client  Number           `json:"client"`
+	Structs []*DecodedStruct `json:"structs"`
+}
+
+// DecodedDeleteItem is a deleted range of a client.
+type DecodedDeleteItem struct {
+	Clock  Number `json:"clock"`
+	Length Number `json:"length"`
+}
+
+// DecodedDeleteSet holds the deleted ranges of one client.
+type DecodedDeleteSet struct {
+	Client Number              `json:"client"`
+	Ranges []DecodedDeleteItem `json:"ranges"`
+}
+
+// DecodedUpdate is a structured, JSON-serializable view of an update.
+type DecodedUpdate struct {
+	Clients   []*DecodedClientStructs `json:"clients"`
+	DeleteSet []*DecodedDeleteSet     `json:"deleteSet"`
+}
+
+// DecodeUpdate decodes an update to a structured view, which is useful to inspect a
+// document that seems to be corrupt.
+func DecodeUpdate(update []uint8) (*DecodedUpdate, error) {
+	return DecodeUpdateV2(update, NewUpdateDecoderV1)
+}
+
+// DecodeUpdateV2 decodes an update like DecodeUpdate with the decoder YDecoder. A corrupt update returns an error
+// instead of panicking.
+func DecodeUpdateV2(update []uint8, YDecoder func([]byte) *UpdateDecoderV1) (decoded *DecodedUpdate, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			decoded = nil
+			err = fmt.Errorf("decode update failed. err:%v", r)
+		}
+	}()
+
+	decoded = &DecodedUpdate{
+		Clients:   make([]*DecodedClientStructs, 0),
+		DeleteSet: make([]*DecodedDeleteSet, 0),
+	}
+	updateDecoder := YDecoder(update)
+	lazyDecoder := NewLazyStructReader(updateDecoder, false, true)
+
+	var curr *DecodedClientStructs
+	for s := lazyDecoder.Curr; s != nil; s = lazyDecoder.Next() {
+		client := s.GetID().Client
+		if curr == nil || curr.Client != client {
+			curr = &DecodedClientStructs{Client: client}
+			decoded.Clients = append(decoded.Clients, curr)
+		}
+
+		curr.Structs = append(curr.Structs, NewDecodedStruct(s))
+	}
+
+	ds := ReadDeleteSet(updateDecoder)
+	if ds == nil {
+		return nil, errors.New("read delete set failed")
+	}
+
+	MapSortedRange(deleteSetSizes(ds), true, func(client, _ Number) {
+		dds := &DecodedDeleteSet{Client: client}
+		for _, item := range ds.Clients[client] {
+			dds.Ranges = append(dds.Ranges, DecodedDeleteItem{Clock: item.Clock, Length: item.Length})
+		}
+		decoded.DeleteSet = append(decoded.DeleteSet, dds)
+	})
+
+	return decoded, nil
+}
+
+// NewDecodedStruct converts a struct read by LazyStructReader to its decoded view.
+func NewDecodedStruct(s IAbstractStruct) *DecodedStruct {
+	ds := &DecodedStruct{
+		ID:     newDecodedID(s.GetID()),
+		Length: s.GetLength(),
+	}
+
+	switch v := s.(type) {
+	case *GC:
+		ds.Kind = "GC"
+	case *Skip:
+		ds.Kind = "Skip"
+	case *Item:
+		ds.Kind = "Item"
+		if v.Origin != nil {
+			origin := newDecodedID(v.Origin)
+			ds.Origin = &origin
+		}
+
+		if v.RightOrigin != nil {
+			rightOrigin := newDecodedID(v.RightOrigin)
+			ds.RightOrigin = &rightOrigin
+		}
+
+		switch p := v.Parent.(type) {
+		case *YString:
+			ds.ParentYKey = p.Str
+		case *ID:
+			parent := newDecodedID(p)
+			ds.Parent = &parent
+		}
+
+		ds.ParentSub = v.ParentSub
+		ds.ContentType = ContentTypeName(v.Content)
+		ds.Preview = ContentPreview(v.Content)
+	}
+
+	return ds
+}
+
+// ContentTypeName returns the name of the content type, e.g. "ContentString".
+func ContentTypeName(content IAbstractContent) string {
+	switch content.(type) {
+	case *ContentDeleted:
+		return "ContentDeleted"
+	case *ContentJson:
+		return "ContentJson"
+	case *ContentBinary:
+		return "ContentBinary"
+	case *ContentString:
+		return "ContentString"
+	case *ContentEmbed:
+		return "ContentEmbed"
+	case *ContentFormat:
+		return "ContentFormat"
+	case *ContentType:
+		return "ContentType"
+	case *ContentAny:
+		return "ContentAny"
+	case *ContentDoc:
+		return "ContentDoc"
+	default:
+		return KeywordUndefined
+	}
+}
+
+// ContentPreview returns a short JSON-serializable preview of the content value.
+func ContentPreview(content IAbstractContent) interface{} {
+	switch c := content.(type) {
+	case *ContentDeleted:
+		return nil
+	case *ContentString:
+		if utf8.RuneCountInString(c.Str) > DecodedPreviewLength {
+			return string([]rune(c.Str)[:DecodedPreviewLength]) + "..."
+		}
+		return c.Str
+	case *ContentBinary:
+		return fmt.Sprintf("<%d bytes>", len(c.Content))
+	case *ContentJson:
+		return previewArray(c.Arr)
+	case *ContentAny:
+		return previewArray(c.Arr)
+	case *ContentEmbed:
+		return previewValue(c.Embed)
+	case *ContentFormat:
+		return Object{c.Key: previewValue(c.Value)}
+	case *ContentDoc:
+		return Object{"guid": c.Doc.Guid, "opts": c.Opts}
+	case *ContentType:
+		return typeRefName(c.Type)
+	default:
+		return nil
+	}
+}
+
+func typeRefName(t IAbstractType) string {
+	switch v := t.(type) {
+	case *YArray:
+		return "YArray"
+	case *YMap:
+		return "YMap"
+	case *YXmlText:
+		return "YXmlText"
+	case *YText:
+		return "YText"
+	case *YXmlElement:
+		return fmt.Sprintf("YXmlElement<%s>", v.NodeName)
+	case *YXmlHook:
+		return fmt.Sprintf("YXmlHook<%s>", v.HookName)
+	case *YXmlFragment:
+		return "YXmlFragment"
+	default:
+		return KeywordUndefined
+	}
+}
+
+// previewValue replaces values that can not be serialized to json.
+func previewValue(v interface{}) interface{} {
+	if IsUndefined(v) || IsNull(v) {
+		return nil
+	}
+
+	return v
+}
+
+func previewArray(arr ArrayAny) ArrayAny {
+	preview := make(ArrayAny, 0, len(arr))
+	for _, v := range arr {
+		preview = append(preview, previewValue(v))
+	}
+	return preview
+}
+
+func newDecodedID(id *ID) DecodedID {
+	return DecodedID{Client: id.Client, Clock: id.Clock}
+}
+
+// deleteSetSizes is used to iterate over the clients of a delete set in sorted order.
+func deleteSetSizes(ds *DeleteSet) map[Number]Number {
+	sizes := make(map[Number]Number, len(ds.Clients))
+	for client, items := range ds.Clients {
+		sizes[client] = len(items)
+	}
+	return sizes
+}
@@ -0,0 +1,66 @@
+package y_crdt
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeUpdate(t *testing.T) {
+	doc := NewDoc("guid", false, nil, nil, false)
+	doc.ClientID = 1
+	ytext := doc.GetText("text")
+	ymap := doc.GetMap("map").(*YMap)
+	doc.Transact(func(trans *Transaction) {
+		ytext.Insert(0, "hello world", nil)
+		ymap.Set("k1", "v1")
+		ymap.Set("nested", NewYArray())
+	}, nil)
+	ytext.Delete(0, 6)
+
+	decoded, err := DecodeUpdate(EncodeStateAsUpdate(doc, nil))
+	if err != nil {
+		t.Fatalf("decode update failed. err:%s", err.Error())
+	}
+
+	if len(decoded.Clients) != 1 || decoded.Clients[0].Client != 1 {
+		t.Fatalf("expected structs of client 1, got %+v", decoded.Clients)
+	}
+
+	var text, nested *DecodedStruct
+	for _, s := range decoded.Clients[0].Structs {
+		if s.Kind != "Item" {
+			t.Errorf("expected item, got %s", s.Kind)
+		}
+
+		if s.ContentType == "ContentString" && s.Preview == "world" {
+			text = s
+		}
+
+		if s.ContentType == "ContentType" {
+			nested = s
+		}
+	}
+
+	if text == nil || text.Origin == nil || text.Origin.Client != 1 {
+		t.Errorf("expected string content with origin, got %+v", text)
+	}
+
+	if nested == nil || nested.ParentYKey != "map" || nested.ParentSub != "nested" || nested.Preview != "YArray" {
+		t.Errorf("expected nested YArray in map, got %+v", nested)
+	}
+
+	if len(decoded.DeleteSet) != 1 || decoded.DeleteSet[0].Ranges[0] != (DecodedDeleteItem{Clock: 0, Length: 6}) {
+		t.Errorf("expected delete set {1: [0, 6]}, got %+v", decoded.DeleteSet)
+	}
+
+	if _, err := json.Marshal(decoded); err != nil {
+		t.Errorf("expected decoded update to be json serializable, err:%s", err.Error())
+	}
+}
+
+func TestDecodeUpdateInvalid(t *testing.T) {
+	_, err := DecodeUpdate([]byte{1, 1, 1, 0, 0x1f})
+	if err == nil {
+		t.Errorf("expected error on invalid update")
+	}
+}
@@ -38,8 +38,8 @@ func NewDeleteSet() *DeleteSet {
 // f func(*GC|*Item)
 func IterateDeletedStructs(trans *Transaction, ds *DeleteSet, f func(s IAbstractStruct)) {
 	for clientId, deletes := range ds.Clients {
-		ss := trans.Doc.Store.Clients[clientId]
-		if len(*ss) == 0 {
+		ss, exist := trans.Doc.Store.Clients[clientId]
+		if !exist || len(*ss) == 0 {
 			continue
 		}
 
@@ -175,7 +175,8 @@ func NewDeleteSetFromStructStore(ss *StructStore) *DeleteSet {
 func WriteDeleteSet(encoder *UpdateEncoderV1, ds *DeleteSet) {
 	WriteVarUint(encoder.RestEncoder, uint64(len(ds.Clients)))
 
-	for client, dsItems := range ds.Clients {
+	for _, client := range sortedDeleteSetClients(ds) {
+		dsItems := ds.Clients[client]
 		encoder.ResetDsCurVal()
 		WriteVarUint(encoder.RestEncoder, uint64(client))
 
@@ -190,10 +191,22 @@ func WriteDeleteSet(encoder *UpdateEncoderV1, ds *DeleteSet) {
 	}
 }
 
+// sortedDeleteSetClients returns the clients of ds in descending order like Yjs, so that the encoding is
+// deterministic.
+func sortedDeleteSetClients(ds *DeleteSet) []Number {
+	clients := make([]Number, 0, len(ds.Clients))
+	for client := range ds.Clients {
+		clients = append(clients, client)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(clients)))
+	return clients
+}
+
 func WriteDeleteSetV2(encoder *UpdateEncoderV2, ds *DeleteSet) {
 	WriteVarUint(encoder.RestEncoder, uint64(len(ds.Clients)))
 
-	for client, dsItems := range ds.Clients {
+	for _, client := range sortedDeleteSetClients(ds) {
+		dsItems := ds.Clients[client]
 		encoder.ResetDsCurVal()
 		WriteVarUint(encoder.RestEncoder, uint64(client))
 
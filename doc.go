@@ -20,6 +20,8 @@ type Doc struct {
 	ShouldLoad   bool
 	AutoLoad     bool
 	Meta         interface{}
+
+	keptStacks map[*UndoManager]struct{} // undo managers whose deleted stack items are kept, see keepStacks
 }
 
 // Notify the parent document that you request to load data into this subdocument (if it is a subdocument).
@@ -44,8 +46,7 @@ func (doc *Doc) GetSubdocs() Set {
 func (doc *Doc) GetSubdocGuids() Set {
 	s := NewSet()
 	for k := range doc.SubDocs {
-		guid := k.(string)
-		s.Add(guid)
+		s.Add(k.(*Doc).Guid)
 	}
 	return s
 }
@@ -171,26 +172,33 @@ func (doc *Doc) ToJson() Object {
 
 // Emit `destroy` event and unregister all event handlers.
 func (doc *Doc) Destroy() {
+	// destroying a subdoc replaces it in SubDocs
+	var subDocs []*Doc
 	for k := range doc.SubDocs {
-		subDoc := k.(*Doc)
+		subDocs = append(subDocs, k.(*Doc))
+	}
+
+	for _, subDoc := range subDocs {
 		subDoc.Destroy()
 	}
 
 	item := doc.Item
 	if item != nil {
 		doc.Item = nil
-		content := item.Content.(*ContentDoc)
-		if item.Deleted() {
-			content.Doc = nil
-		} else {
-			content.Doc = NewDoc(doc.Guid, content.Opts[OptKeyGC].(bool), DefaultGCFilter, content.Opts[OptKeyMeta], content.Opts[OptKeyAutoLoad].(bool))
+		// the item keeps an unloaded instance of the subdoc, so that it can be loaded again. The content of a
+		// deleted item may be garbage collected already.
+		content, ok := item.Content.(*ContentDoc)
+		if ok {
+			content.Doc = NewDocFromOpts(doc.Guid, content.Opts)
+			content.Doc.ShouldLoad = false
 			content.Doc.Item = item
 		}
 
 		Transact(item.Parent.(IAbstractType).GetDoc(), func(trans *Transaction) {
-			if !item.Deleted() {
+			if ok && !item.Deleted() {
 				trans.SubdocsAdded.Add(content.Doc)
 			}
+			trans.SubdocsRemoved.Add(doc)
 		}, nil, true)
 	}
 
@@ -218,6 +226,8 @@ func NewDoc(guid string, gc bool, gcFilter func(item *Item) bool, meta interface
 		AutoLoad:   autoLoad,
 		Store:      NewStructStore(),
 		Share:      make(map[string]IAbstractType),
+		SubDocs:    NewSet(),
+		ShouldLoad: true,
 	}
 
 	return doc
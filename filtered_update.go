@@ -0,0 +1,138 @@
+package y_crdt
+
+// UpdateFilter encodes updates that only contain the content of selected root types, e.g. a client that only
+// displays the comments of a document doesn't need to load the content.
+//
+// Structs of other root types are replaced by GC structs of the same length, so the clocks of every client stay
+// contiguous and the receiving doc can integrate the update. The receiving doc must not be synced with
+// the complete document afterwards, because it already claims to know the replaced structs.
+type UpdateFilter struct {
+	RootTypes Set
+
+	// StateVector is the state that has been sent through the filter,
+	// EncodeUpdate only writes the structs after this state.
+	StateVector map[Number]Number
+}
+
+func NewUpdateFilter(rootTypes ...string) *UpdateFilter {
+	f := &UpdateFilter{
+		RootTypes:   NewSet(),
+		StateVector: make(map[Number]Number),
+	}
+
+	for _, name := range rootTypes {
+		f.RootTypes.Add(name)
+	}
+
+	return f
+}
+
+// EncodeFilteredStateAsUpdate works like EncodeStateAsUpdate, but only writes the structs and deletions of rootTypes.
+// Pending structs that couldn't be integrated yet are not written.
+func EncodeFilteredStateAsUpdate(doc *Doc, rootTypes []string, encodedTargetStateVector []uint8) []uint8 {
+	f := NewUpdateFilter(rootTypes...)
+	if len(encodedTargetStateVector) > 0 {
+		f.StateVector = DecodeStateVector(encodedTargetStateVector)
+	}
+
+	return f.EncodeUpdate(doc)
+}
+
+// EncodeUpdate writes the filtered structs that were not sent yet and the filtered delete set of doc,
+// then advances StateVector to the state of doc. Call it after every transaction, e.g. in the "update"
+// event of doc, to keep the incremental updates filtered.
+func (f *UpdateFilter) EncodeUpdate(doc *Doc) []uint8 {
+	encoder := NewUpdateEncoderV1()
+	store := doc.Store
+	roots := make(map[IAbstractType]string)
+	include := func(s IAbstractStruct) bool {
+		item, ok := s.(*Item)
+		return ok && f.RootTypes.Has(rootTypeName(item, roots))
+	}
+
+	sm := make(map[Number]Number)
+	for client := range store.Clients {
+		if clock := f.StateVector[client]; GetState(store, client) > clock {
+			sm[client] = clock // only write if new structs are available
+		}
+	}
+
+	WriteVarUint(encoder.RestEncoder, uint64(len(sm)))
+	MapSortedRange(sm, false, func(client, clock Number) {
+		writeFilteredStructs(encoder, *store.Clients[client], client, clock, include)
+	})
+
+	ds := NewDeleteSet()
+	for client, structs := range store.Clients {
+		for _, s := range *structs {
+			if s.Deleted() && include(s) {
+				AddToDeleteSet(ds, client, s.GetID().Clock, s.GetLength())
+			}
+		}
+	}
+	SortAndMergeDeleteSet(ds)
+	WriteDeleteSet(encoder, ds)
+
+	f.StateVector = GetStateVector(store)
+	return encoder.ToUint8Array()
+}
+
+// writeFilteredStructs works like WriteStructs, but replaces the structs that are not included by GC structs.
+func writeFilteredStructs(encoder *UpdateEncoderV1, structs []IAbstractStruct, client, clock Number, include func(IAbstractStruct) bool) {
+	clock = Max(clock, structs[0].GetID().Clock)
+	start, _ := FindIndexSS(structs, clock)
+
+	var filtered []IAbstractStruct
+	offset := clock - structs[start].GetID().Clock
+	for i := start; i < len(structs); i++ {
+		s := structs[i]
+		if i > start {
+			offset = 0
+		}
+
+		if include(s) {
+			filtered = append(filtered, s)
+			continue
+		}
+
+		id := s.GetID()
+		gc := NewGC(GenID(client, id.Clock+offset), s.GetLength()-offset)
+		if n := len(filtered); n > 0 && IsSameType(filtered[n-1], gc) && filtered[n-1].MergeWith(gc) {
+			continue
+		}
+		filtered = append(filtered, gc)
+	}
+
+	WriteVarUint(encoder.RestEncoder, uint64(len(filtered)))
+	encoder.WriteClient(client)
+	WriteVarUint(encoder.RestEncoder, uint64(clock))
+
+	for i, s := range filtered {
+		if i == 0 {
+			// a placeholder already starts at clock
+			s.Write(encoder, clock-s.GetID().Clock)
+			continue
+		}
+		s.Write(encoder, 0)
+	}
+}
+
+// rootTypeName returns the name of the root type that item belongs to, roots caches the names of the root types.
+func rootTypeName(item *Item, roots map[IAbstractType]string) string {
+	t, ok := item.Parent.(IAbstractType)
+	for ok && t.GetItem() != nil {
+		t, ok = t.GetItem().Parent.(IAbstractType)
+	}
+
+	if !ok {
+		return ""
+	}
+
+	name, exist := roots[t]
+	if !exist {
+		name = FindRootTypeKey(t)
+		roots[t] = name
+	}
+
+	return name
+}
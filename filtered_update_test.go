@@ -0,0 +1,58 @@
+package y_crdt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeFilteredStateAsUpdate(t *testing.T) {
+	doc := NewDoc("guid", false, nil, nil, false)
+	content := doc.GetText("content")
+	comments := doc.GetArray("comments")
+
+	content.Insert(0, "private content", nil)
+	comment := NewYMap(nil)
+	comments.Insert(0, ArrayAny{comment, "first"})
+	comment.Set("text", "looks good")
+	content.Insert(0, "more ", nil)
+	comments.Insert(2, ArrayAny{"second"})
+	comments.Delete(1, 1)
+	content.Delete(0, 5)
+
+	remote := NewDoc("guid", false, nil, nil, false)
+	ApplyUpdate(remote, EncodeFilteredStateAsUpdate(doc, []string{"comments"}, nil), nil)
+
+	if remote.Store.PendingStructs != nil {
+		t.Fatalf("expected all structs to be integrated")
+	}
+
+	if !reflect.DeepEqual(remote.GetArray("comments").ToJson(), comments.ToJson()) {
+		t.Errorf("expected %v, got %v", comments.ToJson(), remote.GetArray("comments").ToJson())
+	}
+
+	if remote.GetText("content").ToString() != "" {
+		t.Errorf("expected content to be filtered, got %s", remote.GetText("content").ToString())
+	}
+
+	// incremental updates
+	filter := NewUpdateFilter("comments")
+	filter.StateVector = GetStateVector(remote.Store)
+	content.Insert(0, "secret", nil)
+	comments.Insert(0, ArrayAny{"third"})
+	comments.Delete(1, 1)
+
+	update := filter.EncodeUpdate(doc)
+	if bytes.Contains(update, []byte("secret")) {
+		t.Errorf("expected content to be filtered from incremental update")
+	}
+
+	ApplyUpdate(remote, update, nil)
+	if !reflect.DeepEqual(remote.GetArray("comments").ToJson(), comments.ToJson()) {
+		t.Errorf("expected %v, got %v", comments.ToJson(), remote.GetArray("comments").ToJson())
+	}
+
+	if !reflect.DeepEqual(filter.StateVector, GetStateVector(doc.Store)) {
+		t.Errorf("expected filter state to advance to %v, got %v", GetStateVector(doc.Store), filter.StateVector)
+	}
+}
@@ -0,0 +1,309 @@
+package y_crdt
+
+import (
+	"sync"
+	"time"
+)
+
+// Hooks extend a WSSharedDoc on the server, e.g. to index, audit or forward its changes. A hook is added by
+// WSSharedDoc.AddHook and implements one or more of the hook interfaces below.
+
+// LoadHook is called after the stored state of a doc was loaded. An error aborts the load.
+type LoadHook interface {
+	OnLoad(doc *WSSharedDoc) error
+}
+
+// BeforeApplyUpdateHook checks an update of a connection before it is applied, Event.Access describes the
+// update. An error rejects the update like the WritePolicy of the doc.
+type BeforeApplyUpdateHook interface {
+	BeforeApplyUpdate(event *UpdateEvent) error
+}
+
+// AfterApplyUpdateHook is called after each transaction that changed the doc, Event.Transaction holds the
+// BeforeState, AfterState and the Changed types of the transaction.
+type AfterApplyUpdateHook interface {
+	AfterApplyUpdate(event *UpdateEvent)
+}
+
+// AwarenessHook is called when awareness states of the doc are added, changed or removed.
+type AwarenessHook interface {
+	OnAwareness(event *AwarenessEvent)
+}
+
+// ConnectHook is called before a connection is accepted. An error refuses the connection.
+type ConnectHook interface {
+	OnConnect(doc *WSSharedDoc, conn interface{}) error
+}
+
+// DisconnectHook is called when an accepted connection is closed.
+type DisconnectHook interface {
+	OnDisconnect(doc *WSSharedDoc, conn interface{})
+}
+
+// IdleHook is called when the last connection of the doc is closed.
+type IdleHook interface {
+	OnIdle(doc *WSSharedDoc)
+}
+
+// UpdateEvent is the update passed to BeforeApplyUpdateHook and AfterApplyUpdateHook.
+type UpdateEvent struct {
+	Doc         *WSSharedDoc
+	Origin      interface{}   // origin of the transaction, the connection for received updates
+	Update      []byte        // update v1
+	Access      *UpdateAccess // what the update changes, only before the update is applied
+	Transaction *Transaction  // the transaction that applied the update, only after the update is applied
+}
+
+// AwarenessEvent is the awareness change passed to AwarenessHook.
+type AwarenessEvent struct {
+	Doc     *WSSharedDoc
+	Added   []Number
+	Updated []Number // clients whose state is different
+	Removed []Number
+	Origin  interface{}
+}
+
+// AddHook adds hooks to sd, they are called in the order they were added.
+func (sd *WSSharedDoc) AddHook(hooks ...interface{}) {
+	sd.hooks = append(sd.hooks, hooks...)
+}
+
+// Load applies the stored state of sd and calls the LoadHooks. The stored state isn't passed to the
+// AfterApplyUpdateHooks.
+func (sd *WSSharedDoc) Load(update []byte) error {
+	if len(update) > 0 {
+		sd.loading = true
+		err := applyUpdateSafely(sd.Doc, update, sd)
+		sd.loading = false
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(LoadHook); ok {
+			if err := h.OnLoad(sd); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Connect is called by the transport when conn connects. It calls the ConnectHooks, if one returns an error the
+// transport must refuse conn.
+func (sd *WSSharedDoc) Connect(conn interface{}) error {
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(ConnectHook); ok {
+			if err := h.OnConnect(sd, conn); err != nil {
+				return err
+			}
+		}
+	}
+
+	sd.connections++
+	return nil
+}
+
+// Disconnect is called by the transport when an accepted conn is closed. It calls the DisconnectHooks, and the
+// IdleHooks if conn was the last connection.
+func (sd *WSSharedDoc) Disconnect(conn interface{}) {
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(DisconnectHook); ok {
+			h.OnDisconnect(sd, conn)
+		}
+	}
+
+	if sd.connections > 0 {
+		sd.connections--
+	}
+
+	if sd.connections > 0 {
+		return
+	}
+
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(IdleHook); ok {
+			h.OnIdle(sd)
+		}
+	}
+}
+
+// writePolicy checks update of conn by the WritePolicy and the BeforeApplyUpdateHooks of sd.
+func (sd *WSSharedDoc) writePolicy(update []byte, conn interface{}) WritePolicy {
+	var policies []WritePolicy
+	if sd.WritePolicy != nil {
+		policies = append(policies, sd.WritePolicy)
+	}
+
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(BeforeApplyUpdateHook); ok {
+			policies = append(policies, func(access *UpdateAccess) error {
+				return h.BeforeApplyUpdate(&UpdateEvent{Doc: sd, Origin: conn, Update: update, Access: access})
+			})
+		}
+	}
+
+	if len(policies) == 0 {
+		return nil
+	}
+	return AllOf(policies...)
+}
+
+func (sd *WSSharedDoc) afterApplyUpdate(update []byte, origin interface{}, trans *Transaction) {
+	if sd.loading {
+		return
+	}
+
+	var event *UpdateEvent
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(AfterApplyUpdateHook); ok {
+			if event == nil {
+				event = &UpdateEvent{Doc: sd, Origin: origin, Update: update, Transaction: trans}
+			}
+			h.AfterApplyUpdate(event)
+		}
+	}
+}
+
+func (sd *WSSharedDoc) onAwareness(obj Object, origin interface{}) {
+	var event *AwarenessEvent
+	for _, hook := range sd.hooks {
+		if h, ok := hook.(AwarenessHook); ok {
+			if event == nil {
+				event = &AwarenessEvent{
+					Doc:     sd,
+					Added:   obj["added"].([]Number),
+					Updated: obj["updated"].([]Number),
+					Removed: obj["removed"].([]Number),
+					Origin:  origin,
+				}
+			}
+			h.OnAwareness(event)
+		}
+	}
+}
+
+// applyUpdateSafely applies update to doc, it returns ErrInvalidData instead of panicking on a corrupt update.
+func applyUpdateSafely(doc *Doc, update []byte, origin interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrInvalidData
+		}
+	}()
+
+	ApplyUpdate(doc, update, origin)
+	return nil
+}
+
+// Debounced collects the events of each doc and passes them in one call once no event was added for Wait, but at
+// the latest MaxWait after the first collected event. It is the debounced variant of a hook, e.g. to store or
+// index a doc after a burst of changes instead of after every keystroke.
+//
+// The events are passed on a timer goroutine, where the doc must not be accessed without the lock of its owner.
+type Debounced[T any] struct {
+	Wait    time.Duration
+	MaxWait time.Duration // zero means no limit
+
+	f       func(doc *WSSharedDoc, events []T)
+	mutex   sync.Mutex
+	pending map[*WSSharedDoc]*debouncedEvents[T]
+}
+
+type debouncedEvents[T any] struct {
+	events []T
+	first  time.Time
+	timer  *time.Timer
+}
+
+func NewDebounced[T any](wait, maxWait time.Duration, f func(doc *WSSharedDoc, events []T)) *Debounced[T] {
+	return &Debounced[T]{
+		Wait:    wait,
+		MaxWait: maxWait,
+		f:       f,
+		pending: make(map[*WSSharedDoc]*debouncedEvents[T]),
+	}
+}
+
+// Add collects event of doc.
+func (d *Debounced[T]) Add(doc *WSSharedDoc, event T) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	pending, exist := d.pending[doc]
+	if !exist {
+		pending = &debouncedEvents[T]{first: time.Now()}
+		d.pending[doc] = pending
+	}
+
+	pending.events = append(pending.events, event)
+	wait := d.Wait
+	if d.MaxWait > 0 {
+		wait = min(wait, max(d.MaxWait-time.Since(pending.first), 0))
+	}
+
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	pending.timer = time.AfterFunc(wait, func() {
+		d.flush(doc, pending)
+	})
+}
+
+// Flush passes the collected events of all docs immediately, e.g. before the server shuts down.
+func (d *Debounced[T]) Flush() {
+	d.mutex.Lock()
+	pending := d.pending
+	d.pending = make(map[*WSSharedDoc]*debouncedEvents[T])
+	d.mutex.Unlock()
+
+	for doc, p := range pending {
+		p.timer.Stop()
+		d.f(doc, p.events)
+	}
+}
+
+func (d *Debounced[T]) flush(doc *WSSharedDoc, pending *debouncedEvents[T]) {
+	d.mutex.Lock()
+	if d.pending[doc] != pending {
+		// flushed already
+		d.mutex.Unlock()
+		return
+	}
+	delete(d.pending, doc)
+	d.mutex.Unlock()
+
+	d.f(doc, pending.events)
+}
+
+// DebouncedUpdateHook is the debounced variant of AfterApplyUpdateHook. The events are copies that hold the doc,
+// origin and a copy of the update, their Transaction is nil because it is finished when the events are passed.
+type DebouncedUpdateHook struct {
+	*Debounced[*UpdateEvent]
+}
+
+func DebounceAfterApplyUpdate(wait, maxWait time.Duration, f func(doc *WSSharedDoc, events []*UpdateEvent)) DebouncedUpdateHook {
+	return DebouncedUpdateHook{NewDebounced(wait, maxWait, f)}
+}
+
+func (h DebouncedUpdateHook) AfterApplyUpdate(event *UpdateEvent) {
+	h.Add(event.Doc, &UpdateEvent{
+		Doc:    event.Doc,
+		Origin: event.Origin,
+		Update: append([]byte(nil), event.Update...),
+	})
+}
+
+// DebouncedAwarenessHook is the debounced variant of AwarenessHook.
+type DebouncedAwarenessHook struct {
+	*Debounced[*AwarenessEvent]
+}
+
+func DebounceAwareness(wait, maxWait time.Duration, f func(doc *WSSharedDoc, events []*AwarenessEvent)) DebouncedAwarenessHook {
+	return DebouncedAwarenessHook{NewDebounced(wait, maxWait, f)}
+}
+
+func (h DebouncedAwarenessHook) OnAwareness(event *AwarenessEvent) {
+	h.Add(event.Doc, event)
+}
@@ -0,0 +1,183 @@
+package y_crdt
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testHook records the calls of all hooks.
+type testHook struct {
+	calls   []string
+	updates []*UpdateEvent
+	reject  error
+}
+
+func (h *testHook) OnLoad(doc *WSSharedDoc) error {
+	h.calls = append(h.calls, "load "+doc.GetText("text").ToString())
+	return nil
+}
+
+func (h *testHook) BeforeApplyUpdate(event *UpdateEvent) error {
+	h.calls = append(h.calls, "before")
+	return h.reject
+}
+
+func (h *testHook) AfterApplyUpdate(event *UpdateEvent) {
+	h.calls = append(h.calls, "after")
+	h.updates = append(h.updates, event)
+}
+
+func (h *testHook) OnAwareness(event *AwarenessEvent) {
+	h.calls = append(h.calls, "awareness")
+}
+
+func (h *testHook) OnConnect(doc *WSSharedDoc, conn interface{}) error {
+	h.calls = append(h.calls, "connect "+conn.(string))
+	return nil
+}
+
+func (h *testHook) OnDisconnect(doc *WSSharedDoc, conn interface{}) {
+	h.calls = append(h.calls, "disconnect "+conn.(string))
+}
+
+func (h *testHook) OnIdle(doc *WSSharedDoc) {
+	h.calls = append(h.calls, "idle")
+}
+
+func TestHooks(t *testing.T) {
+	stored := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	stored.GetText("text").Insert(0, "stored", nil)
+
+	hook := &testHook{}
+	hub := NewSyncHub("doc")
+	defer hub.Close()
+	hub.Doc.AddHook(hook)
+	if err := hub.Doc.Load(EncodeStateAsUpdate(stored, nil)); err != nil {
+		t.Fatalf("load failed. err:%s", err.Error())
+	}
+
+	a, _ := hub.Connect("a", "a", nil)
+	b, _ := hub.Connect("b", "b", nil)
+
+	client := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(client, EncodeStateAsUpdate(hub.Doc.Doc, nil), nil)
+	var update []byte
+	client.On("update", NewObserverHandler(func(v ...interface{}) {
+		update = v[0].([]byte)
+	}))
+
+	client.GetText("text").Insert(6, "!", nil)
+	encoder := NewUpdateEncoderV1()
+	WriteVarUint(encoder.RestEncoder, MessageSync)
+	WriteUpdate(encoder, update)
+	if err := hub.Receive(a, encoder.ToUint8Array()); err != nil {
+		t.Fatalf("receive update failed. err:%s", err.Error())
+	}
+
+	if len(hook.updates) != 1 {
+		t.Fatalf("expected one applied update, got %d", len(hook.updates))
+	}
+
+	event := hook.updates[0]
+	if event.Origin != "a" || !reflect.DeepEqual(event.Update, update) || event.Transaction.AfterState[client.ClientID] != 1 {
+		t.Errorf("expected update of a with its transaction, got %+v", event)
+	}
+
+	if _, exist := event.Transaction.Changed[hub.Doc.GetText("text")]; !exist {
+		t.Errorf("expected text to be changed by the transaction")
+	}
+
+	// a rejected update is not applied
+	hook.reject = errors.New("frozen")
+	client.GetText("text").Insert(0, "x", nil)
+	encoder = NewUpdateEncoderV1()
+	WriteVarUint(encoder.RestEncoder, MessageSync)
+	WriteUpdate(encoder, update)
+	if err := hub.Receive(a, encoder.ToUint8Array()); err == nil || err.Error() != "frozen" {
+		t.Errorf("expected update to be rejected by the hook, got %v", err)
+	}
+
+	clientAwareness := NewAwarenessWithClock(client, &fakeClock{})
+	clientAwareness.SetLocalState(Object{"name": "a"})
+	awareness := NewEncoder()
+	WriteVarUint(awareness, MessageAwareness)
+	WriteVarUint8Array(awareness, EncodeAwarenessUpdate(clientAwareness, []Number{client.ClientID}, nil))
+	hub.Receive(a, awareness.Bytes())
+
+	hub.Disconnect(a)
+	hub.Disconnect(b)
+	hub.Disconnect(b)
+
+	expected := []string{
+		"load stored",
+		"connect a",
+		"connect b",
+		"before",
+		"after",
+		"before",
+		"awareness",
+		"awareness", // the awareness state of a is removed
+		"disconnect a",
+		"disconnect b",
+		"idle",
+	}
+	if !reflect.DeepEqual(hook.calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, hook.calls)
+	}
+}
+
+func TestDebouncedHooks(t *testing.T) {
+	events := make(chan []*UpdateEvent, 10)
+	hook := DebounceAfterApplyUpdate(20*time.Millisecond, time.Hour, func(doc *WSSharedDoc, e []*UpdateEvent) {
+		events <- e
+	})
+
+	doc := NewWSSharedDoc("doc", nil, nil)
+	defer doc.Destroy()
+	doc.AddHook(hook)
+	for i := 0; i < 3; i++ {
+		doc.GetText("text").Insert(0, "a", nil)
+	}
+
+	select {
+	case e := <-events:
+		if len(e) != 3 {
+			t.Errorf("expected 3 debounced updates, got %d", len(e))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected debounced updates")
+	}
+
+	// the events are passed at the latest after MaxWait, even if the doc keeps changing
+	hook.Wait = time.Hour
+	hook.MaxWait = 20 * time.Millisecond
+	doc.GetText("text").Insert(0, "b", nil)
+	select {
+	case e := <-events:
+		if len(e) != 1 {
+			t.Errorf("expected 1 debounced update, got %d", len(e))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected debounced updates after max wait")
+	}
+
+	// Flush passes the collected events immediately
+	hook.MaxWait = 0
+	doc.GetText("text").Insert(0, "c", nil)
+	hook.Flush()
+	if e := <-events; len(e) != 1 || e[0].Doc != doc {
+		t.Errorf("expected flushed update of doc, got %+v", e)
+	}
+
+	// the events don't share the update and transaction of the hook call
+	update := []byte{1, 2, 3}
+	hook.AfterApplyUpdate(&UpdateEvent{Doc: doc, Origin: "conn", Update: update, Transaction: &Transaction{}})
+	update[0] = 9
+	hook.Flush()
+	if e := <-events; !bytes.Equal(e[0].Update, []byte{1, 2, 3}) || e[0].Origin != "conn" || e[0].Transaction != nil {
+		t.Errorf("expected copy of the event without transaction, got %+v", e[0])
+	}
+}
@@ -0,0 +1,125 @@
+package y_crdt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ObfuscatorOptions define which parts of an update are obfuscated besides the user content.
+type ObfuscatorOptions struct {
+	Formatting bool // obfuscate the keys and values of format attributes
+	Subdocs    bool // obfuscate the guid and the meta of subdocuments
+	YXml       bool // obfuscate the node names of xml elements and hooks
+}
+
+// DefaultObfuscatorOptions obfuscates everything.
+func DefaultObfuscatorOptions() *ObfuscatorOptions {
+	return &ObfuscatorOptions{
+		Formatting: true,
+		Subdocs:    true,
+		YXml:       true,
+	}
+}
+
+// ObfuscateUpdate replaces the content of an update with placeholders, so that the update can be shared
+// for debugging purposes without exposing private data.
+//
+// Strings, binaries and arrays keep their length, and every id, origin and the delete set are preserved.
+// So the obfuscated update produces the same document structure as the original update.
+// Equal map keys, node names and format attributes are replaced by equal placeholders.
+func ObfuscateUpdate(update []uint8, opts *ObfuscatorOptions) ([]uint8, error) {
+	return ObfuscateUpdateV2(update, opts, NewUpdateDecoderV1, NewUpdateEncoderV1)
+}
+
+// ObfuscateUpdateV2 is ObfuscateUpdate with the decoder and encoder of the update, it uses the default options if
+// opts is nil.
+func ObfuscateUpdateV2(update []uint8, opts *ObfuscatorOptions, YDecoder func([]byte) *UpdateDecoderV1, YEncoder func() *UpdateEncoderV1) ([]uint8, error) {
+	if opts == nil {
+		opts = DefaultObfuscatorOptions()
+	}
+
+	return ConvertUpdateFormat(update, NewObfuscator(opts), YDecoder, YEncoder)
+}
+
+// NewObfuscator creates a block transformer that replaces the content of structs with placeholders.
+func NewObfuscator(opts *ObfuscatorOptions) func(s IAbstractStruct) IAbstractStruct {
+	i := 0
+	mapKeyCache := make(map[string]string)
+	nodeNameCache := make(map[string]string)
+	formattingKeyCache := make(map[string]string)
+	formattingValueCache := make(map[string]interface{})
+
+	setIfUndefined := func(cache map[string]string, key string, create func() string) string {
+		value, exist := cache[key]
+		if !exist {
+			value = create()
+			cache[key] = value
+		}
+		return value
+	}
+
+	return func(s IAbstractStruct) IAbstractStruct {
+		item, ok := s.(*Item)
+		if !ok {
+			// GC and Skip don't hold any content
+			return s
+		}
+
+		placeholder := strconv.Itoa(i)
+		switch c := item.Content.(type) {
+		case *ContentDeleted:
+		case *ContentType:
+			if opts.YXml {
+				switch t := c.Type.(type) {
+				case *YXmlElement:
+					t.NodeName = setIfUndefined(nodeNameCache, t.NodeName, func() string { return "node-" + placeholder })
+				case *YXmlHook:
+					t.HookName = setIfUndefined(nodeNameCache, t.HookName, func() string { return "hook-" + placeholder })
+				}
+			}
+		case *ContentAny:
+			for n := range c.Arr {
+				c.Arr[n] = i
+			}
+		case *ContentJson:
+			for n := range c.Arr {
+				c.Arr[n] = i
+			}
+		case *ContentBinary:
+			for n := range c.Content {
+				c.Content[n] = uint8(i)
+			}
+		case *ContentDoc:
+			if opts.Subdocs {
+				c.Doc.Guid = placeholder
+				delete(c.Opts, OptKeyMeta)
+			}
+		case *ContentEmbed:
+			c.Embed = NewObject()
+		case *ContentFormat:
+			if opts.Formatting {
+				c.Key = setIfUndefined(formattingKeyCache, c.Key, func() string { return placeholder })
+
+				// the end of a formatting range must stay the end of a formatting range
+				if c.Value != nil {
+					valueKey := JsonString(c.Value)
+					value, exist := formattingValueCache[valueKey]
+					if !exist {
+						value = Object{"i": i}
+						formattingValueCache[valueKey] = value
+					}
+					c.Value = value
+				}
+			}
+		case *ContentString:
+			c.Str = strings.Repeat(strconv.Itoa(i%10), c.GetLength())
+		}
+
+		if item.ParentSub != "" {
+			item.ParentSub = setIfUndefined(mapKeyCache, item.ParentSub, func() string { return placeholder })
+		}
+
+		i++
+		return item
+	}
+}
@@ -0,0 +1,62 @@
+package y_crdt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateUpdate(t *testing.T) {
+	doc := NewDoc("guid", false, nil, nil, false)
+	ytext := doc.GetText("text")
+	ymap := doc.GetMap("map").(*YMap)
+	doc.Transact(func(trans *Transaction) {
+		ytext.Insert(0, "secret text", Object{"bold": true})
+		ymap.Set("password", "123456")
+		ymap.Set("token", []uint8{1, 2, 3})
+	}, nil)
+	ytext.Delete(0, 7)
+	ymap.Set("password", "654321")
+
+	update := EncodeStateAsUpdate(doc, nil)
+	obfuscated, err := ObfuscateUpdate(update, nil)
+	if err != nil {
+		t.Fatalf("obfuscate update failed. err:%s", err.Error())
+	}
+
+	if strings.Contains(string(obfuscated), "secret") || strings.Contains(string(obfuscated), "password") ||
+		strings.Contains(string(obfuscated), "654321") || strings.Contains(string(obfuscated), "bold") {
+		t.Errorf("expected private content to be removed, got %q", obfuscated)
+	}
+
+	// ids, origins and the delete set are kept.
+	decoded, _ := DecodeUpdate(update)
+	decodedObfuscated, _ := DecodeUpdate(obfuscated)
+	if !reflect.DeepEqual(decoded.DeleteSet, decodedObfuscated.DeleteSet) {
+		t.Errorf("expected delete set %+v, got %+v", decoded.DeleteSet, decodedObfuscated.DeleteSet)
+	}
+
+	structs, obfuscatedStructs := decoded.Clients[0].Structs, decodedObfuscated.Clients[0].Structs
+	if len(structs) != len(obfuscatedStructs) {
+		t.Fatalf("expected %d structs, got %d", len(structs), len(obfuscatedStructs))
+	}
+
+	for i := range structs {
+		s, o := structs[i], obfuscatedStructs[i]
+		if s.ID != o.ID || s.Length != o.Length || !reflect.DeepEqual(s.Origin, o.Origin) ||
+			!reflect.DeepEqual(s.RightOrigin, o.RightOrigin) || s.ContentType != o.ContentType {
+			t.Errorf("expected struct %+v, got %+v", s, o)
+		}
+	}
+
+	remote := NewDoc("guid", false, nil, nil, false)
+	ApplyUpdate(remote, obfuscated, nil)
+	if remote.GetText("text").GetLength() != ytext.GetLength() {
+		t.Errorf("expected text length %d, got %d", ytext.GetLength(), remote.GetText("text").GetLength())
+	}
+
+	// both versions of a key are obfuscated to the same placeholder.
+	if keys := remote.GetMap("map").(*YMap).ToJson().(Object); len(keys) != 2 {
+		t.Errorf("expected 2 keys, got %v", keys)
+	}
+}
@@ -56,6 +56,25 @@ func (p *PermanentUserData) SetUserMapping(doc *Doc, clientID Number, userDescri
 	}))
 }
 
+// AddClientID records that clientID belongs to userDescription, without tracking the deletions of the local doc
+// like SetUserMapping does. It is used by a server that knows the owners of the clients.
+func (p *PermanentUserData) AddClientID(clientID Number, userDescription string) {
+	users := p.YUsers.(*YMap)
+	p.Doc.Transact(func(trans *Transaction) {
+		user, ok := users.Get(userDescription).(*YMap)
+		if !ok {
+			user = NewYMap(nil)
+			user.Set("ids", NewYArray())
+			user.Set("ds", NewYArray())
+			users.Set(userDescription, user)
+		}
+
+		user.Get("ids").(*YArray).Push(ArrayAny{clientID})
+	}, nil)
+
+	p.Clients[clientID] = userDescription
+}
+
 func (p *PermanentUserData) GetUserByClientID(clientID Number) string {
 	return p.Clients[clientID]
 }
@@ -96,9 +115,12 @@ func NewPermanentUserData(doc *Doc, storeType IAbstractType) *PermanentUserData
 			p.Clients[clientID] = userDescription
 		}
 
-		ds.ObserveDeep(func(e interface{}, t interface{}) {
-			event := e.(*YArrayEvent)
-			a := event.Changes["added"].(Set)
+		ds.Observe(func(e interface{}, t interface{}) {
+			event, ok := e.(*YArrayEvent)
+			if !ok {
+				return
+			}
+			a := event.GetChanges()["added"].(Set)
 			a.Range(func(element interface{}) {
 				item, ok := element.(*Item)
 				if ok {
@@ -168,7 +190,9 @@ func NewPermanentUserData(doc *Doc, storeType IAbstractType) *PermanentUserData
 	})
 
 	storeType.(*YMap).ForEach(func(s string, i interface{}, yMap *YMap) {
-		initUser(yMap, s)
+		if user, ok := i.(*YMap); ok {
+			initUser(user, s)
+		}
 	})
 
 	return p
@@ -0,0 +1,28 @@
+package y_crdt
+
+import (
+	"testing"
+)
+
+func TestPermanentUserDataRemoteDeleteSets(t *testing.T) {
+	alice := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	bob := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	sync := func() {
+		ApplyUpdate(bob, EncodeStateAsUpdate(alice, EncodeStateVector(bob, nil, NewUpdateEncoderV1())), "sync")
+	}
+
+	NewPermanentUserData(alice, nil).SetUserMapping(alice, alice.ClientID, "alice", func(trans *Transaction, ds *DeleteSet) bool {
+		return true
+	})
+	alice.GetText("text").Insert(0, "hello", nil)
+	sync()
+
+	// the user data of bob observes the deletions that alice adds later
+	pud := NewPermanentUserData(bob, nil)
+	alice.GetText("text").Delete(0, 2)
+	sync()
+
+	if user := pud.GetUserByDeletedID(&alice.GetText("text").Start.ID); user != "alice" {
+		t.Errorf("expected deletion of alice, got %q", user)
+	}
+}
@@ -0,0 +1,200 @@
+package y_crdt
+
+import (
+	"encoding/json"
+)
+
+// Presence is a typed view of the states of an Awareness. The states are converted from and to T by encoding/json,
+// so T defines the state by its json tags.
+type Presence[T any] struct {
+	Awareness *Awareness
+}
+
+// PresenceChange is a decoded "change" event of the awareness. Clients whose state can't be decoded to T
+// are ignored.
+type PresenceChange[T any] struct {
+	Added   map[Number]T
+	Updated map[Number]T
+	Removed []Number
+	Origin  interface{}
+}
+
+func NewPresence[T any](awareness *Awareness) *Presence[T] {
+	return &Presence[T]{Awareness: awareness}
+}
+
+// SetLocal sets the local state of the awareness to state.
+func (p *Presence[T]) SetLocal(state T) error {
+	object, err := presenceObject(state)
+	if err != nil {
+		return err
+	}
+
+	p.Awareness.SetLocalState(object)
+	return nil
+}
+
+// Local returns the local state, false if it is not set.
+func (p *Presence[T]) Local() (T, bool) {
+	return p.Get(p.Awareness.ClientID)
+}
+
+// Get returns the state of a client, false if the client has no state or its state can't be decoded to T.
+func (p *Presence[T]) Get(clientID Number) (T, bool) {
+	var state T
+	object, exist := p.Awareness.GetStates()[clientID]
+	if !exist || object == nil {
+		return state, false
+	}
+
+	return state, presenceDecode(object, &state) == nil
+}
+
+// States returns the states of all clients that can be decoded to T.
+func (p *Presence[T]) States() map[Number]T {
+	states := make(map[Number]T)
+	for clientID := range p.Awareness.GetStates() {
+		if state, ok := p.Get(clientID); ok {
+			states[clientID] = state
+		}
+	}
+
+	return states
+}
+
+// Observe calls f on every change of the states, the returned handler is used to unobserve.
+func (p *Presence[T]) Observe(f func(change *PresenceChange[T])) *ObserverHandler {
+	handler := NewObserverHandler(func(v ...interface{}) {
+		obj := v[0].(Object)
+		change := &PresenceChange[T]{
+			Added:   make(map[Number]T),
+			Updated: make(map[Number]T),
+		}
+
+		if len(v) > 1 {
+			change.Origin = v[1]
+		}
+
+		for _, clientID := range obj["added"].([]Number) {
+			if state, ok := p.Get(clientID); ok {
+				change.Added[clientID] = state
+			}
+		}
+
+		for _, clientID := range obj["updated"].([]Number) {
+			if state, ok := p.Get(clientID); ok {
+				change.Updated[clientID] = state
+			}
+		}
+
+		change.Removed = obj["removed"].([]Number)
+		f(change)
+	})
+
+	p.Awareness.On("change", handler)
+	return handler
+}
+
+func (p *Presence[T]) Unobserve(handler *ObserverHandler) {
+	p.Awareness.Off("change", handler)
+}
+
+func presenceObject(state interface{}) (Object, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var object Object
+	if err = json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func presenceDecode(object Object, state interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, state)
+}
+
+// RelativePositionJSON is the json form of a RelativePosition in an awareness state, it is compatible with
+// Y.relativePositionToJSON of yjs.
+type RelativePositionJSON struct {
+	Type  *DecodedID `json:"type,omitempty"`
+	Tname string     `json:"tname,omitempty"`
+	Item  *DecodedID `json:"item,omitempty"`
+	Assoc Number     `json:"assoc"`
+}
+
+func NewRelativePositionJSON(rpos *RelativePosition) *RelativePositionJSON {
+	j := &RelativePositionJSON{
+		Tname: rpos.Tname,
+		Assoc: rpos.Assoc,
+	}
+
+	// the type of a root type is only identified by its name
+	if rpos.Type != nil && rpos.Tname == "" {
+		id := newDecodedID(rpos.Type)
+		j.Type = &id
+	}
+
+	if rpos.Item != nil {
+		id := newDecodedID(rpos.Item)
+		j.Item = &id
+	}
+
+	return j
+}
+
+func (j *RelativePositionJSON) RelativePosition() *RelativePosition {
+	rpos := &RelativePosition{
+		Tname: j.Tname,
+		Assoc: j.Assoc,
+	}
+
+	if j.Type != nil {
+		id := GenID(j.Type.Client, j.Type.Clock)
+		rpos.Type = &id
+	}
+
+	if j.Item != nil {
+		id := GenID(j.Item.Client, j.Item.Clock)
+		rpos.Item = &id
+	}
+
+	return rpos
+}
+
+// Cursor is a selection in a type, anchored by relative positions so that it moves with the concurrent changes
+// of the type. Add it to the state of a Presence to share the selection of a user.
+type Cursor struct {
+	Anchor *RelativePositionJSON `json:"anchor"`
+	Head   *RelativePositionJSON `json:"head"`
+}
+
+// NewCursor creates a cursor that selects from index anchor to index head of t.
+func NewCursor(t IAbstractType, anchor, head Number) *Cursor {
+	return &Cursor{
+		Anchor: NewRelativePositionJSON(NewRelativePositionFromTypeIndex(t, anchor, 0)),
+		Head:   NewRelativePositionJSON(NewRelativePositionFromTypeIndex(t, head, 0)),
+	}
+}
+
+// Resolve returns the current positions of the cursor in doc, nil if a position can't be resolved, e.g. because
+// doc doesn't know the anchored item yet.
+func (c *Cursor) Resolve(doc *Doc) (anchor, head *AbsolutePosition) {
+	if c.Anchor != nil {
+		anchor = CreateAbsolutePositionFromRelativePosition(c.Anchor.RelativePosition(), doc)
+	}
+
+	if c.Head != nil {
+		head = CreateAbsolutePositionFromRelativePosition(c.Head.RelativePosition(), doc)
+	}
+
+	return anchor, head
+}
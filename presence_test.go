@@ -0,0 +1,73 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testUserState struct {
+	Name   string  `json:"name"`
+	Cursor *Cursor `json:"cursor,omitempty"`
+}
+
+func TestPresence(t *testing.T) {
+	doc1 := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	doc2 := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc1.GetText("text")
+	text.Insert(0, "hello world", nil)
+	ApplyUpdate(doc2, EncodeStateAsUpdate(doc1, nil), nil)
+
+	aw1 := NewAwarenessWithClock(doc1, &fakeClock{})
+	aw2 := NewAwarenessWithClock(doc2, &fakeClock{})
+	p1 := NewPresence[testUserState](aw1)
+	p2 := NewPresence[testUserState](aw2)
+
+	var changes []*PresenceChange[testUserState]
+	handler := p2.Observe(func(change *PresenceChange[testUserState]) {
+		changes = append(changes, change)
+	})
+
+	if err := p1.SetLocal(testUserState{Name: "alice", Cursor: NewCursor(text, 0, 5)}); err != nil {
+		t.Fatalf("set local state failed. err:%s", err.Error())
+	}
+
+	if local, ok := p1.Local(); !ok || local.Name != "alice" {
+		t.Errorf("expected local state of alice, got %+v", local)
+	}
+
+	ApplyAwarenessUpdate(aw2, EncodeAwarenessUpdate(aw1, []Number{aw1.ClientID}, nil), "remote")
+	if len(changes) != 1 || changes[0].Added[aw1.ClientID].Name != "alice" || changes[0].Origin != "remote" {
+		t.Fatalf("expected alice to be added, got %+v", changes)
+	}
+
+	// the cursor moves with the changes of doc2
+	doc2.GetText("text").Insert(0, "oh, ", nil)
+	alice, _ := p2.Get(aw1.ClientID)
+	anchor, head := alice.Cursor.Resolve(doc2)
+	if anchor == nil || head == nil || anchor.Index != 4 || head.Index != 9 {
+		t.Errorf("expected cursor from 4 to 9, got %+v %+v", anchor, head)
+	}
+
+	// a cursor at the end of a root type is anchored by the name of the type
+	p1.SetLocal(testUserState{Name: "alice", Cursor: NewCursor(text, text.GetLength(), text.GetLength())})
+	ApplyAwarenessUpdate(aw2, EncodeAwarenessUpdate(aw1, []Number{aw1.ClientID}, nil), "remote")
+	if len(changes) != 2 || changes[1].Updated[aw1.ClientID].Cursor.Head.Tname != "text" {
+		t.Fatalf("expected cursor of alice to be updated, got %+v", changes)
+	}
+
+	_, head = p2.States()[aw1.ClientID].Cursor.Resolve(doc2)
+	if head == nil || head.Index != doc2.GetText("text").GetLength() {
+		t.Errorf("expected cursor at the end of the text, got %+v", head)
+	}
+
+	RemoveAwarenessStates(aw2, []Number{aw1.ClientID}, "timeout")
+	if len(changes) != 3 || !reflect.DeepEqual(changes[2].Removed, []Number{aw1.ClientID}) {
+		t.Errorf("expected alice to be removed, got %+v", changes)
+	}
+
+	p2.Unobserve(handler)
+	aw2.SetLocalState(Object{"name": "bob"})
+	if len(changes) != 3 {
+		t.Errorf("expected no changes after unobserve")
+	}
+}
@@ -2,7 +2,12 @@ package y_crdt
 
 import (
 	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestAwareness(t *testing.T) {
@@ -92,6 +97,209 @@ func TestAwareness(t *testing.T) {
 	}
 }
 
+// fakeClock is an Clock whose time is advanced by the test.
+type fakeClock struct {
+	now   int64
+	ticks []func()
+}
+
+func (c *fakeClock) Now() int64 {
+	return c.now
+}
+
+func (c *fakeClock) Every(interval time.Duration, f func()) func() {
+	i := len(c.ticks)
+	c.ticks = append(c.ticks, f)
+	return func() {
+		c.ticks[i] = nil
+	}
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now += d.Milliseconds()
+	for _, f := range c.ticks {
+		if f != nil {
+			f()
+		}
+	}
+}
+
+func TestAwarenessOutdatedStates(t *testing.T) {
+	clock := &fakeClock{}
+	doc1 := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	doc2 := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	aw1 := NewAwarenessWithClock(doc1, clock)
+	aw2 := NewAwarenessWithClock(doc2, clock)
+	aw2.SetLocalState(Object{"user": "remote"})
+	ApplyAwarenessUpdate(aw1, EncodeAwarenessUpdate(aw2, []Number{aw2.ClientID}, nil), "remote")
+
+	var changes, updates []Object
+	aw1.On("change", NewObserverHandler(func(v ...interface{}) {
+		changes = append(changes, v[0].(Object))
+	}))
+	aw1.On("update", NewObserverHandler(func(v ...interface{}) {
+		updates = append(updates, v[0].(Object))
+	}))
+
+	// the local state is renewed without a change
+	clock.Advance(OutdatedTimeout / 2)
+	if len(changes) != 0 || len(updates) != 1 || aw1.Meta[aw1.ClientID]["clock"] != 1 {
+		t.Errorf("expected local state to be renewed, got changes %v, updates %v", changes, updates)
+	}
+
+	if aw1.GetStates()[aw2.ClientID] == nil {
+		t.Errorf("expected remote state not to be outdated yet")
+	}
+
+	// the remote state is outdated, aw2 doesn't send updates to aw1
+	clock.Advance(OutdatedTimeout / 2)
+	if aw1.GetStates()[aw2.ClientID] != nil {
+		t.Errorf("expected outdated remote state to be removed")
+	}
+
+	if len(changes) != 1 || !reflect.DeepEqual(changes[0]["removed"], []Number{aw2.ClientID}) {
+		t.Errorf("expected change with removed remote client, got %v", changes)
+	}
+
+	if aw1.GetLocalState() == nil {
+		t.Errorf("expected local state never to be outdated")
+	}
+
+	// no checks after destroy
+	aw1.Destroy()
+	aw2.Destroy()
+	n := len(updates)
+	clock.Advance(OutdatedTimeout)
+	if len(updates) != n {
+		t.Errorf("expected no checks after destroy")
+	}
+}
+
+func TestApplyAwarenessUpdateWithOptions(t *testing.T) {
+	clock := &fakeClock{}
+	remote1 := NewAwarenessWithClock(NewDoc("doc", true, DefaultGCFilter, nil, false), clock)
+	remote2 := NewAwarenessWithClock(NewDoc("doc", true, DefaultGCFilter, nil, false), clock)
+	remote1.SetLocalState(Object{"name": "alice", "secret": "token"})
+	remote2.SetLocalState(Object{"name": strings.Repeat("x", 100)})
+
+	// a combined update of both remote clients
+	encoder := NewEncoder()
+	WriteVarUint(encoder, 2)
+	for _, aw := range []*Awareness{remote1, remote2} {
+		WriteVarUint(encoder, uint64(aw.ClientID))
+		WriteVarUint(encoder, uint64(aw.Meta[aw.ClientID]["clock"].(Number)))
+		WriteString(encoder, JsonString(aw.GetLocalState()))
+	}
+	update := encoder.Bytes()
+
+	aw := NewAwarenessWithClock(NewDoc("doc", true, DefaultGCFilter, nil, false), clock)
+	var origins []interface{}
+	aw.On("update", NewObserverHandler(func(v ...interface{}) {
+		origins = append(origins, v[1])
+	}))
+
+	if _, err := ApplyAwarenessUpdateWithOptions(aw, update[:len(update)-3], nil); err != ErrInvalidData {
+		t.Errorf("expected invalid data error, got %v", err)
+	}
+
+	if len(aw.GetStates()) != 1 {
+		t.Errorf("expected malformed update not to be applied")
+	}
+
+	filter := func(clientID Number, state Object, size int) (Object, error) {
+		if size > 64 {
+			return nil, errors.New("state too large")
+		}
+		delete(state, "secret")
+		return state, nil
+	}
+
+	change, err := ApplyAwarenessUpdateWithOptions(aw, update, &AwarenessUpdateOptions{Origin: "conn", Filter: filter})
+	if err == nil || !strings.Contains(err.Error(), "state too large") {
+		t.Errorf("expected error of rejected state, got %v", err)
+	}
+
+	if !reflect.DeepEqual(change.Added, []Number{remote1.ClientID}) || len(origins) != 1 || origins[0] != "conn" {
+		t.Errorf("expected remote1 to be added by conn, got %+v %v", change, origins)
+	}
+
+	if !reflect.DeepEqual(aw.GetStates()[remote1.ClientID], Object{"name": "alice"}) {
+		t.Errorf("expected secret to be filtered, got %v", aw.GetStates()[remote1.ClientID])
+	}
+
+	if _, exist := aw.GetStates()[remote2.ClientID]; exist {
+		t.Errorf("expected state of remote2 to be rejected")
+	}
+
+	// silent
+	remote1.SetLocalState(Object{"name": "bob"})
+	change, err = ApplyAwarenessUpdateWithOptions(aw, EncodeAwarenessUpdate(remote1, []Number{remote1.ClientID}, nil), &AwarenessUpdateOptions{Silent: true})
+	if err != nil || !reflect.DeepEqual(change.Changed, []Number{remote1.ClientID}) || !reflect.DeepEqual(change.Updated, []Number{remote1.ClientID}) {
+		t.Errorf("expected remote1 to be changed, got %+v %v", change, err)
+	}
+
+	if len(origins) != 1 {
+		t.Errorf("expected silent update not to emit events")
+	}
+}
+
+func TestAwarenessLimits(t *testing.T) {
+	clock := &fakeClock{}
+	aw := NewAwarenessWithClock(NewDoc("doc", true, DefaultGCFilter, nil, false), clock)
+	aw.Limits = &AwarenessLimits{
+		MaxStateSize:  64,
+		MaxClients:    2,
+		AllowedFields: []string{"name"},
+		Transform: func(clientID Number, state Object) Object {
+			state["verified"] = false
+			return state
+		},
+	}
+
+	var broadcast [][]Number
+	aw.On("update", NewObserverHandler(func(v ...interface{}) {
+		broadcast = append(broadcast, v[0].(Object)["added"].([]Number))
+	}))
+
+	remote := func(state Object) *Awareness {
+		r := NewAwarenessWithClock(NewDoc("doc", true, DefaultGCFilter, nil, false), clock)
+		r.SetLocalState(state)
+		return r
+	}
+
+	alice := remote(Object{"name": "alice", "color": "red"})
+	_, err := ApplyAwarenessUpdateWithOptions(aw, EncodeAwarenessUpdate(alice, []Number{alice.ClientID}, nil), nil)
+	if err != nil {
+		t.Fatalf("expected state of alice to be applied, err:%s", err.Error())
+	}
+
+	if !reflect.DeepEqual(aw.GetStates()[alice.ClientID], Object{"name": "alice", "verified": false}) {
+		t.Errorf("expected allowed fields and transform, got %v", aw.GetStates()[alice.ClientID])
+	}
+
+	large := remote(Object{"name": strings.Repeat("x", 64)})
+	_, err = ApplyAwarenessUpdateWithOptions(aw, EncodeAwarenessUpdate(large, []Number{large.ClientID}, nil), nil)
+	if !errors.Is(err, ErrAwarenessStateTooLarge) {
+		t.Errorf("expected state too large error, got %v", err)
+	}
+
+	bob := remote(Object{"name": "bob"})
+	_, err = ApplyAwarenessUpdateWithOptions(aw, EncodeAwarenessUpdate(bob, []Number{bob.ClientID}, nil), nil)
+	if !errors.Is(err, ErrTooManyAwarenessClients) {
+		t.Errorf("expected too many clients error, got %v", err)
+	}
+
+	if len(aw.GetStates()) != 2 || len(broadcast) != 1 {
+		t.Errorf("expected rejected states not to be applied or broadcast, got %v %v", aw.GetStates(), broadcast)
+	}
+
+	// existing clients can still update their state
+	alice.SetLocalState(Object{"name": "alice 2"})
+	if _, err = ApplyAwarenessUpdateWithOptions(aw, EncodeAwarenessUpdate(alice, []Number{alice.ClientID}, nil), nil); err != nil {
+		t.Errorf("expected update of alice to be applied, err:%s", err.Error())
+	}
+}
+
 func TestSync(t *testing.T) {
 	// ReadSyncMessage
 	var mask = []byte{0x1, 0x3, 0x7, 0xf, 0x1f, 0x3f, 0x7f}
@@ -170,3 +378,85 @@ func TestSync(t *testing.T) {
 		t.Errorf("expected encoder to be non-nil")
 	}
 }
+
+func TestSyncChunked(t *testing.T) {
+	server := NewWSSharedDoc("doc", nil, nil)
+	server.MaxMessageSize = 128
+	server.GetText("text").Insert(0, strings.Repeat("0123456789", 100), nil)
+	server.GetMap("map").(*YMap).Set("key", "value")
+
+	client := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	step1 := NewUpdateEncoderV1()
+	WriteSyncStep1(step1, client)
+
+	messages, messageType := ReadSyncMessageChunked(NewUpdateDecoderV1(step1.ToUint8Array()), server.Doc, nil, server.MaxMessageSize)
+	if messageType != MessageYjsSyncStep1 || len(messages) < 2 {
+		t.Fatalf("expected step2 to be split, got %d messages", len(messages))
+	}
+
+	for i, message := range messages {
+		if len(message) > server.MaxMessageSize {
+			t.Errorf("expected messages of at most %d bytes, got %d", server.MaxMessageSize, len(message))
+		}
+
+		messageType := ReadSyncMessage(NewUpdateDecoderV1(message), NewUpdateEncoderV1(), client, nil)
+		if i == len(messages)-1 && messageType != MessageYjsSyncStep2 {
+			t.Errorf("expected last message to be sync step2, got %d", messageType)
+		}
+
+		if i < len(messages)-1 && messageType != MessageYjsUpdate {
+			t.Errorf("expected update message, got %d", messageType)
+		}
+	}
+
+	if client.GetText("text").ToString() != server.GetText("text").ToString() {
+		t.Errorf("expected %s, got %s", server.GetText("text").ToString(), client.GetText("text").ToString())
+	}
+
+	if client.GetMap("map").(*YMap).Get("key") != "value" {
+		t.Errorf("expected map to be synced")
+	}
+
+	// broadcast of large updates
+	var broadcast [][]byte
+	server.docUpdateHandler = func(message []byte) {
+		broadcast = append(broadcast, message)
+	}
+	server.GetText("text").Insert(0, strings.Repeat("abcdefghij", 50), nil)
+
+	if len(broadcast) < 2 {
+		t.Fatalf("expected broadcast update to be split, got %d messages", len(broadcast))
+	}
+
+	for _, message := range broadcast {
+		if len(message) > server.MaxMessageSize {
+			t.Errorf("expected messages of at most %d bytes, got %d", server.MaxMessageSize, len(message))
+		}
+
+		decoder := NewUpdateDecoderV1(message)
+		if ReadVarUint(decoder.RestDecoder) != MessageSync {
+			t.Fatalf("expected sync message")
+		}
+		ReadSyncMessage(decoder, NewUpdateEncoderV1(), client, nil)
+	}
+
+	if client.GetText("text").ToString() != server.GetText("text").ToString() {
+		t.Errorf("expected %s, got %s", server.GetText("text").ToString(), client.GetText("text").ToString())
+	}
+}
+
+func TestLockedClock(t *testing.T) {
+	clock := &fakeClock{}
+	var mutex sync.Mutex
+	var locked []bool
+	stop := LockedClock{clock, &mutex}.Every(time.Second, func() {
+		locked = append(locked, !mutex.TryLock())
+	})
+
+	clock.Advance(time.Second)
+	stop()
+	clock.Advance(time.Second)
+	if !reflect.DeepEqual(locked, []bool{true}) {
+		t.Errorf("expected f to be called once while the mutex is locked, got %v", locked)
+	}
+}
@@ -258,7 +258,8 @@ func CreateAbsolutePositionFromRelativePosition(rpos *RelativePosition, doc *Doc
 		}
 	} else {
 		if tname != "" {
-			t = doc.GetMap(tname)
+			// the root type may be defined with any constructor
+			t, _ = doc.Get(tname, NewAbstractType)
 		} else if typeID != nil {
 			if GetState(store, typeID.Client) <= typeID.Clock {
 				// type does not exist yet
@@ -0,0 +1,396 @@
+package y_crdt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// estimated memory of a struct and a type without their content
+	structMemory = 120
+	typeMemory   = 200
+)
+
+// ErrRoomManagerClosed is returned when a room is opened after the manager was closed.
+var ErrRoomManagerClosed = errors.New("room manager closed")
+
+// Persistence loads and stores the state of the docs of a RoomManager.
+type Persistence interface {
+	// Load returns the stored update of a doc, nil if nothing is stored.
+	Load(name string) ([]byte, error)
+
+	// Store replaces the stored update of a doc.
+	Store(name string, update []byte) error
+}
+
+// Room is a doc of a RoomManager and its connections.
+type Room struct {
+	Name string
+	Hub  *SyncHub // nil until the doc is loaded
+
+	mutex       *sync.Mutex // mutex of the RoomManager, it guards the fields below and Hub
+	connections int
+	lastUsed    time.Time     // last time the room was opened or released
+	memory      int64         // estimated memory of the doc
+	unloading   bool          // the doc is stored to be unloaded
+	ready       chan struct{} // closed when the load finished
+	err         error         // error of the load
+}
+
+// Connections returns the number of open connections of the room.
+func (r *Room) Connections() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.connections
+}
+
+// RoomManager creates the docs of a server on demand and unloads them when they are not used anymore.
+//
+// A room is loaded from the persistence when it is opened first. After the last connection is released and
+// IdleTimeout passed, Sweep stores the doc and destroys it together with its awareness. If the estimated memory
+// of all docs exceeds MemoryBudget, the least recently used rooms without connections are unloaded early.
+type RoomManager struct {
+	Persistence  Persistence   // nil keeps the docs only in memory
+	IdleTimeout  time.Duration // grace period before an unused room is unloaded
+	MemoryBudget int64         // bytes, 0 means no budget
+
+	// NewHub creates the hub of a room, e.g. to set the write policy or add hooks. NewSyncHub if nil.
+	NewHub func(name string) *SyncHub
+
+	mutex  sync.Mutex
+	rooms  map[string]*Room
+	closed bool
+	now    func() time.Time
+}
+
+func NewRoomManager(persistence Persistence, idleTimeout time.Duration, memoryBudget int64) *RoomManager {
+	return &RoomManager{
+		Persistence:  persistence,
+		IdleTimeout:  idleTimeout,
+		MemoryBudget: memoryBudget,
+		rooms:        make(map[string]*Room),
+		now:          time.Now,
+	}
+}
+
+// Open returns the room name and counts a new connection, the room is created if it isn't loaded.
+// Every Open must be followed by a Release when the connection is closed.
+//
+// The persistence is accessed without holding the lock of the manager, so that a slow load or store of one room
+// doesn't block the other rooms.
+func (m *RoomManager) Open(name string) (*Room, error) {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil, ErrRoomManagerClosed
+	}
+
+	room, exist := m.rooms[name]
+	if !exist {
+		room = &Room{Name: name, mutex: &m.mutex, ready: make(chan struct{})}
+		m.rooms[name] = room
+	}
+
+	room.connections++
+	room.lastUsed = m.now()
+	m.mutex.Unlock()
+
+	if !exist {
+		m.load(room)
+	}
+
+	<-room.ready
+	if room.err != nil {
+		return nil, room.err
+	}
+
+	m.evict()
+	return room, nil
+}
+
+// Release counts a closed connection of room.
+func (m *RoomManager) Release(room *Room) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if room.connections > 0 {
+		room.connections--
+	}
+
+	room.lastUsed = m.now()
+	room.memory = estimateHubMemory(room.Hub)
+}
+
+// Sweep unloads the rooms without connections whose grace period passed, and updates the memory estimations.
+// Call it periodically, e.g. by Start.
+func (m *RoomManager) Sweep() error {
+	m.mutex.Lock()
+	var idle []*Room
+	now := m.now()
+	for _, room := range m.rooms {
+		if room.Hub == nil || room.unloading {
+			continue
+		}
+
+		if room.connections == 0 && now.Sub(room.lastUsed) >= m.IdleTimeout {
+			room.unloading = true
+			idle = append(idle, room)
+			continue
+		}
+
+		room.memory = estimateHubMemory(room.Hub)
+	}
+	m.mutex.Unlock()
+
+	err := m.unload(idle, false)
+	m.evict()
+	return err
+}
+
+// Start calls Sweep every interval until stop is called.
+func (m *RoomManager) Start(interval time.Duration) (stop func()) {
+	return SystemClock.Every(interval, func() {
+		if err := m.Sweep(); err != nil {
+			Logf("[crdt] sweep rooms failed. err:%s", err.Error())
+		}
+	})
+}
+
+// Flush stores the docs of all rooms without unloading them.
+func (m *RoomManager) Flush() error {
+	var errs []error
+	for _, room := range m.loaded(false) {
+		errs = append(errs, m.store(room))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close unloads all rooms, the connections of the rooms are closed.
+func (m *RoomManager) Close() error {
+	m.mutex.Lock()
+	m.closed = true
+	m.mutex.Unlock()
+
+	return m.unload(m.loaded(true), true)
+}
+
+// loaded returns the loaded rooms that are not unloaded already, they are marked as unloading if unloading is true.
+func (m *RoomManager) loaded(unloading bool) []*Room {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var rooms []*Room
+	for _, room := range m.rooms {
+		if room.Hub != nil && !room.unloading {
+			room.unloading = unloading
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
+// Rooms returns the names of the loaded rooms.
+func (m *RoomManager) Rooms() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	names := make([]string, 0, len(m.rooms))
+	for name, room := range m.rooms {
+		if room.Hub != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MemoryUsage returns the estimated memory of all loaded docs, as of the last Open, Release or Sweep.
+func (m *RoomManager) MemoryUsage() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var usage int64
+	for _, room := range m.rooms {
+		usage += room.memory
+	}
+	return usage
+}
+
+// load loads the doc of room and publishes it, or the error of the load.
+func (m *RoomManager) load(room *Room) {
+	var hub *SyncHub
+	if m.NewHub != nil {
+		hub = m.NewHub(room.Name)
+	} else {
+		hub = NewSyncHub(room.Name)
+	}
+
+	var update []byte
+	var err error
+	if m.Persistence != nil {
+		update, err = m.Persistence.Load(room.Name)
+	}
+
+	if err == nil {
+		hub.mutex.Lock()
+		err = hub.Doc.Load(update)
+		hub.mutex.Unlock()
+	}
+
+	if err != nil {
+		err = fmt.Errorf("load room %s failed. err:%w", room.Name, err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err == nil && m.closed {
+		err = ErrRoomManagerClosed
+	}
+
+	if err != nil {
+		hub.Close()
+		delete(m.rooms, room.Name)
+		room.err = err
+	} else {
+		room.Hub = hub
+		room.memory = estimateHubMemory(hub)
+	}
+	close(room.ready)
+}
+
+func (m *RoomManager) store(room *Room) error {
+	if m.Persistence == nil {
+		return nil
+	}
+
+	room.Hub.mutex.Lock()
+	update := EncodeStateAsUpdate(room.Hub.Doc.Doc, nil)
+	room.Hub.mutex.Unlock()
+
+	if err := m.Persistence.Store(room.Name, update); err != nil {
+		return fmt.Errorf("store room %s failed. err:%w", room.Name, err)
+	}
+	return nil
+}
+
+// unload stores the docs of rooms, which are marked as unloading, and destroys them. If a doc can't be stored, or
+// its room was opened again while it was stored and force is false, the room stays loaded.
+func (m *RoomManager) unload(rooms []*Room, force bool) error {
+	var errs []error
+	for _, room := range rooms {
+		err := m.store(room)
+
+		m.mutex.Lock()
+		room.unloading = false
+		unload := err == nil && (force || room.connections == 0)
+		if unload {
+			delete(m.rooms, room.Name)
+		}
+		m.mutex.Unlock()
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if unload {
+			// closing the hub destroys the doc, which destroys the awareness
+			room.Hub.Close()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// evict unloads the least recently used rooms without connections until the memory budget is kept.
+func (m *RoomManager) evict() {
+	if m.MemoryBudget <= 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	var usage int64
+	var idle []*Room
+	for _, room := range m.rooms {
+		if room.Hub == nil || room.unloading {
+			continue
+		}
+
+		usage += room.memory
+		if room.connections == 0 {
+			idle = append(idle, room)
+		}
+	}
+
+	sort.Slice(idle, func(i, j int) bool {
+		return idle[i].lastUsed.Before(idle[j].lastUsed)
+	})
+
+	var evicted []*Room
+	for _, room := range idle {
+		if usage <= m.MemoryBudget {
+			break
+		}
+
+		room.unloading = true
+		evicted = append(evicted, room)
+		usage -= room.memory
+	}
+	m.mutex.Unlock()
+
+	if usage > m.MemoryBudget {
+		Logf("[crdt] rooms exceed the memory budget. usage:%d budget:%d", usage, m.MemoryBudget)
+	}
+
+	if err := m.unload(evicted, false); err != nil {
+		Logf("[crdt] evict rooms failed. err:%s", err.Error())
+	}
+}
+
+func estimateHubMemory(hub *SyncHub) int64 {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return EstimateDocMemory(hub.Doc.Doc)
+}
+
+// EstimateDocMemory estimates the memory of the structs and their content in the store of doc.
+func EstimateDocMemory(doc *Doc) int64 {
+	var memory int64
+	for _, structs := range doc.Store.Clients {
+		for _, s := range *structs {
+			memory += structMemory
+			if item, ok := s.(*Item); ok {
+				memory += estimateContentMemory(item.Content)
+			}
+		}
+	}
+
+	return memory
+}
+
+func estimateContentMemory(content IAbstractContent) int64 {
+	switch c := content.(type) {
+	case *ContentString:
+		return int64(len(c.Str))
+	case *ContentBinary:
+		return int64(len(c.Content))
+	case *ContentAny:
+		return int64(len(JsonString(c.Arr)))
+	case *ContentJson:
+		return int64(len(JsonString(c.Arr)))
+	case *ContentEmbed:
+		return int64(len(JsonString(c.Embed)))
+	case *ContentFormat:
+		return int64(len(c.Key) + len(JsonString(c.Value)))
+	case *ContentType:
+		return typeMemory
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,204 @@
+package y_crdt
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryPersistence map[string][]byte
+
+func (p memoryPersistence) Load(name string) ([]byte, error) {
+	return p[name], nil
+}
+
+func (p memoryPersistence) Store(name string, update []byte) error {
+	p[name] = update
+	return nil
+}
+
+func TestRoomManager(t *testing.T) {
+	persistence := memoryPersistence{}
+	manager := NewRoomManager(persistence, time.Minute, 0)
+	now := time.Unix(0, 0)
+	manager.now = func() time.Time { return now }
+	defer manager.Close()
+
+	room, err := manager.Open("a")
+	if err != nil {
+		t.Fatalf("open room failed. err:%s", err.Error())
+	}
+
+	room.Hub.mutex.Lock()
+	room.Hub.Doc.GetText("text").Insert(0, "hello", nil)
+	room.Hub.mutex.Unlock()
+
+	same, _ := manager.Open("a")
+	if same != room || room.Connections() != 2 {
+		t.Fatalf("expected the loaded room with 2 connections, got %d", room.Connections())
+	}
+
+	manager.Release(room)
+	manager.Release(room)
+	now = now.Add(30 * time.Second)
+	manager.Sweep()
+	if !reflect.DeepEqual(manager.Rooms(), []string{"a"}) {
+		t.Fatalf("expected room to stay loaded during the grace period, got %v", manager.Rooms())
+	}
+
+	now = now.Add(30 * time.Second)
+	if err = manager.Sweep(); err != nil {
+		t.Fatalf("sweep failed. err:%s", err.Error())
+	}
+
+	if len(manager.Rooms()) != 0 || persistence["a"] == nil {
+		t.Fatalf("expected idle room to be stored and unloaded, got %v", manager.Rooms())
+	}
+
+	if room.Hub.Doc.Awareness.stopCheckInterval != nil {
+		t.Errorf("expected awareness of the unloaded room to be destroyed")
+	}
+
+	room, _ = manager.Open("a")
+	if s := room.Hub.Doc.GetText("text").ToString(); s != "hello" {
+		t.Errorf("expected room to be loaded from persistence, got %s", s)
+	}
+}
+
+func TestRoomConnectionsConcurrent(t *testing.T) {
+	manager := NewRoomManager(nil, time.Minute, 0)
+	defer manager.Close()
+
+	room, err := manager.Open("a")
+	if err != nil {
+		t.Fatalf("open room failed. err:%s", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				manager.Open("a")
+				room.Connections()
+				manager.Release(room)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := room.Connections(); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+}
+
+func TestRoomManagerMemoryBudget(t *testing.T) {
+	persistence := memoryPersistence{}
+	manager := NewRoomManager(persistence, time.Hour, 0)
+	now := time.Unix(0, 0)
+	manager.now = func() time.Time { return now }
+	defer manager.Close()
+
+	var rooms []*Room
+	for _, name := range []string{"a", "b", "c"} {
+		now = now.Add(time.Second)
+		room, _ := manager.Open(name)
+		room.Hub.mutex.Lock()
+		room.Hub.Doc.GetText("text").Insert(0, string(make([]byte, 1000)), nil)
+		room.Hub.mutex.Unlock()
+		rooms = append(rooms, room)
+	}
+
+	for _, room := range rooms {
+		now = now.Add(time.Second)
+		manager.Release(room)
+	}
+
+	memory := EstimateDocMemory(rooms[0].Hub.Doc.Doc)
+	if memory < 1000 || manager.MemoryUsage() != 3*memory {
+		t.Fatalf("expected estimation of the content, got %d of %d", memory, manager.MemoryUsage())
+	}
+
+	// a is used again, so b is the least recently used room
+	now = now.Add(time.Second)
+	manager.Open("a")
+	manager.Release(rooms[0])
+
+	manager.MemoryBudget = 2 * memory
+	manager.Sweep()
+	if !reflect.DeepEqual(manager.Rooms(), []string{"a", "c"}) {
+		t.Errorf("expected the least recently used room to be evicted, got %v", manager.Rooms())
+	}
+
+	if persistence["b"] == nil {
+		t.Errorf("expected evicted room to be stored")
+	}
+
+	// rooms with connections are never evicted
+	manager.Open("a")
+	manager.Open("c")
+	manager.MemoryBudget = 1
+	manager.Sweep()
+	if !reflect.DeepEqual(manager.Rooms(), []string{"a", "c"}) {
+		t.Errorf("expected rooms with connections to stay loaded, got %v", manager.Rooms())
+	}
+}
+
+// blockingPersistence blocks Store until release is closed, the first store is sent to storing.
+type blockingPersistence struct {
+	memoryPersistence
+	storing chan string
+	release chan struct{}
+}
+
+func (p *blockingPersistence) Store(name string, update []byte) error {
+	select {
+	case p.storing <- name:
+	default:
+	}
+	<-p.release
+	return p.memoryPersistence.Store(name, update)
+}
+
+func TestRoomManagerSlowStore(t *testing.T) {
+	persistence := &blockingPersistence{
+		memoryPersistence: memoryPersistence{},
+		storing:           make(chan string, 1),
+		release:           make(chan struct{}),
+	}
+
+	manager := NewRoomManager(persistence, 0, 0)
+	room, _ := manager.Open("a")
+	manager.Release(room)
+
+	swept := make(chan error)
+	go func() { swept <- manager.Sweep() }()
+	<-persistence.storing
+
+	// the store of a doesn't block other rooms, and a can be opened again while it is stored
+	if _, err := manager.Open("b"); err != nil {
+		t.Fatalf("open room failed. err:%s", err.Error())
+	}
+
+	same, _ := manager.Open("a")
+	if same != room {
+		t.Fatalf("expected the room being stored to be returned")
+	}
+
+	close(persistence.release)
+	if err := <-swept; err != nil {
+		t.Fatalf("sweep failed. err:%s", err.Error())
+	}
+
+	if !reflect.DeepEqual(manager.Rooms(), []string{"a", "b"}) {
+		t.Errorf("expected the opened room to stay loaded, got %v", manager.Rooms())
+	}
+
+	if persistence.memoryPersistence["a"] == nil {
+		t.Errorf("expected the room to be stored")
+	}
+
+	manager.Close()
+}
@@ -89,13 +89,17 @@ func IsVisible(item *Item, snapshot *Snapshot) bool {
 	return state > item.ID.Clock && !IsDeleted(snapshot.Ds, &item.ID)
 }
 
+// SplitSnapshotAffectedStructsOrigin is the origin of the transactions that split the structs for a snapshot and
+// the key of the split snapshots in Transaction.Meta. Yjs uses the function itself, a func is no valid map key.
+const SplitSnapshotAffectedStructsOrigin = "splitSnapshotAffectedStructs"
+
 func SplitSnapshotAffectedStructs(trans *Transaction, snapshot *Snapshot) {
-	_, exist := trans.Meta[SplitSnapshotAffectedStructs]
+	_, exist := trans.Meta[SplitSnapshotAffectedStructsOrigin]
 	if !exist {
-		trans.Meta[SplitSnapshotAffectedStructs] = NewSet()
+		trans.Meta[SplitSnapshotAffectedStructsOrigin] = NewSet()
 	}
 
-	meta := trans.Meta[SplitSnapshotAffectedStructs]
+	meta := trans.Meta[SplitSnapshotAffectedStructsOrigin]
 	store := trans.Doc.Store
 
 	// check if we already split for this snapshot
@@ -0,0 +1,294 @@
+package y_crdt
+
+import (
+	"sort"
+	"strconv"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "updated"
+)
+
+// TextChange is a range of text that was added or removed between two snapshots. Index is the position of the
+// range in the text of the snapshot that contains it: next for added, prev for removed text.
+type TextChange struct {
+	Type  string
+	Index Number
+	Text  string
+}
+
+// ArrayChange is a range of elements that were added or removed between two snapshots, Index as of TextChange.
+type ArrayChange struct {
+	Type   string
+	Index  Number
+	Values ArrayAny
+}
+
+// MapChange is a key that was added, removed or updated between two snapshots.
+type MapChange struct {
+	Type string
+	Key  string
+	Old  interface{} // nil if added
+	New  interface{} // nil if removed
+}
+
+// SnapshotDiff lists the changes between two snapshots by the path of the changed types, see Paths. The
+// children of an xml element or fragment are diffed like an array, its attributes like a map, an xml text like a
+// text.
+//
+// Changes inside a nested type are listed only if the type exists in both snapshots, a type that was added or
+// removed as a whole is a change of its parent.
+type SnapshotDiff struct {
+	Texts  map[string][]TextChange
+	Arrays map[string][]ArrayChange
+	Maps   map[string][]MapChange
+}
+
+// Paths returns the sorted paths of the changed types.
+func (d *SnapshotDiff) Paths() []string {
+	paths := NewSet()
+	for path := range d.Texts {
+		paths.Add(path)
+	}
+	for path := range d.Arrays {
+		paths.Add(path)
+	}
+	for path := range d.Maps {
+		paths.Add(path)
+	}
+
+	var result []string
+	for path := range paths {
+		result = append(result, path.(string))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// DiffSnapshots returns the changes of the root types of doc from prev to next. A nil prev is the empty doc, a nil
+// next is the current state of doc. It returns ErrGCEnabled if doc uses GC, the deleted content isn't kept then.
+//
+// If a struct of doc spans a boundary of a snapshot, it is split in a transaction with the origin
+// SplitSnapshotAffectedStructsOrigin. The transaction doesn't change the content, so it emits no update, but the
+// beforeTransaction and afterTransaction observers of doc are called.
+func DiffSnapshots(doc *Doc, prev, next *Snapshot) (*SnapshotDiff, error) {
+	if doc.GC {
+		return nil, ErrGCEnabled
+	}
+
+	if prev == nil {
+		prev = EmptySnapshot()
+	}
+
+	diff := &SnapshotDiff{
+		Texts:  make(map[string][]TextChange),
+		Arrays: make(map[string][]ArrayChange),
+		Maps:   make(map[string][]MapChange),
+	}
+
+	names := make([]string, 0, len(doc.Share))
+	for name := range doc.Share {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	diffTypes := func() {
+		for _, name := range names {
+			diff.diffType(doc.Share[name], name, prev, next)
+		}
+	}
+
+	if !needsSplit(doc.Store, prev) && (next == nil || !needsSplit(doc.Store, next)) {
+		diffTypes()
+		return diff, nil
+	}
+
+	// split the structs, so that an item is completely visible or invisible in a snapshot
+	Transact(doc, func(trans *Transaction) {
+		SplitSnapshotAffectedStructs(trans, prev)
+		if next != nil {
+			SplitSnapshotAffectedStructs(trans, next)
+		}
+		diffTypes()
+	}, SplitSnapshotAffectedStructsOrigin, true)
+
+	return diff, nil
+}
+
+// needsSplit reports whether a struct of store spans the state or a deleted range of snapshot.
+func needsSplit(store *StructStore, snapshot *Snapshot) bool {
+	inside := func(client, clock Number) bool {
+		structs, exist := store.Clients[client]
+		if !exist || clock >= GetState(store, client) {
+			return false
+		}
+
+		index, err := FindIndexSS(*structs, clock)
+		return err == nil && (*structs)[index].GetID().Clock != clock
+	}
+
+	for client, clock := range snapshot.Sv {
+		if inside(client, clock) {
+			return true
+		}
+	}
+
+	for client, deleteItems := range snapshot.Ds.Clients {
+		for _, del := range deleteItems {
+			if inside(client, del.Clock) || inside(client, del.Clock+del.Length) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *SnapshotDiff) diffType(t IAbstractType, path string, prev, next *Snapshot) {
+	switch t.(type) {
+	case *YText, *YXmlText:
+		d.diffText(t, path, prev, next)
+	default:
+		d.diffList(t, path, prev, next)
+	}
+	d.diffMap(t, path, prev, next)
+}
+
+func (d *SnapshotDiff) diffText(t IAbstractType, path string, prev, next *Snapshot) {
+	var changes []TextChange
+	var prevIndex, nextIndex Number
+	for n := t.StartItem(); n != nil; n = n.Right {
+		if !n.Countable() {
+			continue
+		}
+
+		inPrev, inNext := IsVisible(n, prev), IsVisible(n, next)
+		var change TextChange
+		switch {
+		case inPrev && inNext:
+			prevIndex += n.Length
+			nextIndex += n.Length
+			continue
+		case inNext:
+			change = TextChange{Type: ChangeAdded, Index: nextIndex}
+			nextIndex += n.Length
+		case inPrev:
+			change = TextChange{Type: ChangeRemoved, Index: prevIndex}
+			prevIndex += n.Length
+		default:
+			continue
+		}
+
+		if s, ok := n.Content.(*ContentString); ok {
+			change.Text = s.Str
+		} else {
+			// embeds and types count as one character, see YText.ToDelta
+			change.Text = "\uFFFC"
+		}
+
+		// join the change with the previous one if they are adjacent
+		if last := len(changes) - 1; last >= 0 && changes[last].Type == change.Type &&
+			changes[last].Index+StringLength(changes[last].Text) == change.Index {
+			changes[last].Text += change.Text
+		} else {
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) > 0 {
+		d.Texts[path] = changes
+	}
+}
+
+func (d *SnapshotDiff) diffList(t IAbstractType, path string, prev, next *Snapshot) {
+	var changes []ArrayChange
+	var prevIndex, nextIndex Number
+	for n := t.StartItem(); n != nil; n = n.Right {
+		if !n.Countable() {
+			continue
+		}
+
+		inPrev, inNext := IsVisible(n, prev), IsVisible(n, next)
+		var change ArrayChange
+		switch {
+		case inPrev && inNext:
+			if c, ok := n.Content.(*ContentType); ok {
+				d.diffType(c.Type, path+"."+strconv.Itoa(nextIndex), prev, next)
+			}
+			prevIndex += n.Length
+			nextIndex += n.Length
+			continue
+		case inNext:
+			change = ArrayChange{Type: ChangeAdded, Index: nextIndex}
+			nextIndex += n.Length
+		case inPrev:
+			change = ArrayChange{Type: ChangeRemoved, Index: prevIndex}
+			prevIndex += n.Length
+		default:
+			continue
+		}
+
+		change.Values = n.Content.GetContent()
+		if last := len(changes) - 1; last >= 0 && changes[last].Type == change.Type &&
+			changes[last].Index+len(changes[last].Values) == change.Index {
+			changes[last].Values = append(changes[last].Values, change.Values...)
+		} else {
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) > 0 {
+		d.Arrays[path] = changes
+	}
+}
+
+func (d *SnapshotDiff) diffMap(t IAbstractType, path string, prev, next *Snapshot) {
+	keys := make([]string, 0, len(t.GetMap()))
+	for key := range t.GetMap() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []MapChange
+	for _, key := range keys {
+		before, after := mapItemAt(t, key, prev), mapItemAt(t, key, next)
+		switch {
+		case before == nil && after == nil:
+		case before == nil:
+			changes = append(changes, MapChange{Type: ChangeAdded, Key: key, New: mapItemValue(after)})
+		case after == nil:
+			changes = append(changes, MapChange{Type: ChangeRemoved, Key: key, Old: mapItemValue(before)})
+		case before != after:
+			changes = append(changes, MapChange{Type: ChangeUpdated, Key: key, Old: mapItemValue(before), New: mapItemValue(after)})
+		default:
+			if c, ok := after.Content.(*ContentType); ok {
+				d.diffType(c.Type, path+"."+key, prev, next)
+			}
+		}
+	}
+
+	if len(changes) > 0 {
+		d.Maps[path] = changes
+	}
+}
+
+// mapItemAt returns the item of key that is visible in snapshot, like TypeMapGetSnapshot. A nil snapshot is the
+// current state.
+func mapItemAt(t IAbstractType, key string, snapshot *Snapshot) *Item {
+	item := t.GetMap()[key]
+	if snapshot != nil {
+		for item != nil && item.ID.Clock >= snapshot.Sv[item.ID.Client] {
+			item = item.Left
+		}
+	}
+
+	if item != nil && IsVisible(item, snapshot) {
+		return item
+	}
+	return nil
+}
+
+func mapItemValue(item *Item) interface{} {
+	return item.Content.GetContent()[item.Length-1]
+}
@@ -0,0 +1,170 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	settings := doc.GetMap("settings").(*YMap)
+	list := doc.GetArray("list")
+	body := doc.GetXmlFragment("body").(*YXmlFragment)
+
+	text.Insert(0, "hello world", nil)
+	settings.Set("theme", "dark")
+	settings.Set("size", 12)
+	nested := NewYMap(nil)
+	settings.Set("nested", nested)
+	nested.Set("a", 1)
+	list.Insert(0, ArrayAny{1, 2, 3, 4})
+	paragraph := NewYXmlElement("p")
+	body.Insert(0, ArrayAny{paragraph})
+	paragraph.Insert(0, ArrayAny{NewYXmlText()})
+	paragraph.Get(0).(*YXmlText).Insert(0, "first", nil)
+	prev := NewSnapshotByDoc(doc)
+
+	text.Delete(0, 6)
+	text.Insert(0, "goodbye ", nil)
+	text.Insert(text.GetLength(), "!", nil)
+	settings.Set("theme", "light")
+	settings.Delete("size")
+	settings.Set("lang", "en")
+	nested.Set("b", 2)
+	list.Delete(1, 2)
+	list.Insert(2, ArrayAny{5})
+	paragraph.SetAttribute("class", "intro")
+	paragraph.Get(0).(*YXmlText).Insert(5, " line", nil)
+	body.Insert(1, ArrayAny{NewYXmlElement("hr")})
+	next := NewSnapshotByDoc(doc)
+
+	// later changes are not part of the diff
+	text.Insert(0, "later ", nil)
+
+	diff, err := DiffSnapshots(doc, prev, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedText := []TextChange{
+		{Type: ChangeRemoved, Index: 0, Text: "hello "},
+		{Type: ChangeAdded, Index: 0, Text: "goodbye "},
+		{Type: ChangeAdded, Index: 13, Text: "!"},
+	}
+	if !reflect.DeepEqual(diff.Texts["text"], expectedText) {
+		t.Errorf("expected text changes %v, got %v", expectedText, diff.Texts["text"])
+	}
+
+	expectedMap := []MapChange{
+		{Type: ChangeAdded, Key: "lang", New: "en"},
+		{Type: ChangeRemoved, Key: "size", Old: 12},
+		{Type: ChangeUpdated, Key: "theme", Old: "dark", New: "light"},
+	}
+	if !reflect.DeepEqual(diff.Maps["settings"], expectedMap) {
+		t.Errorf("expected map changes %v, got %v", expectedMap, diff.Maps["settings"])
+	}
+
+	if changes := diff.Maps["settings.nested"]; len(changes) != 1 || changes[0].Key != "b" || changes[0].Type != ChangeAdded {
+		t.Errorf("expected change of the nested map, got %v", changes)
+	}
+
+	expectedList := []ArrayChange{
+		{Type: ChangeRemoved, Index: 1, Values: ArrayAny{2, 3}},
+		{Type: ChangeAdded, Index: 2, Values: ArrayAny{5}},
+	}
+	if !reflect.DeepEqual(diff.Arrays["list"], expectedList) {
+		t.Errorf("expected array changes %v, got %v", expectedList, diff.Arrays["list"])
+	}
+
+	// xml children, attributes and text
+	if changes := diff.Arrays["body"]; len(changes) != 1 || changes[0].Index != 1 || changes[0].Type != ChangeAdded {
+		t.Errorf("expected hr to be added, got %v", changes)
+	}
+
+	if changes := diff.Maps["body.0"]; len(changes) != 1 || changes[0].Key != "class" || changes[0].New != "intro" {
+		t.Errorf("expected class attribute to be added, got %v", changes)
+	}
+
+	if changes := diff.Texts["body.0.0"]; len(changes) != 1 || changes[0].Text != " line" || changes[0].Index != 5 {
+		t.Errorf("expected xml text change, got %v", changes)
+	}
+
+	expectedPaths := []string{"body", "body.0", "body.0.0", "list", "settings", "settings.nested", "text"}
+	if paths := diff.Paths(); !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("expected paths %v, got %v", expectedPaths, paths)
+	}
+
+	// the current state and the empty doc
+	current, _ := DiffSnapshots(doc, next, nil)
+	if changes := current.Texts["text"]; len(changes) != 1 || changes[0].Text != "later " {
+		t.Errorf("expected change of the current state, got %v", changes)
+	}
+
+	empty, _ := DiffSnapshots(doc, nil, prev)
+	if changes := empty.Arrays["list"]; len(changes) != 1 || len(changes[0].Values) != 4 {
+		t.Errorf("expected all elements to be added, got %v", changes)
+	}
+
+	// the deleted content of a doc with GC is lost
+	gcDoc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	if _, err := DiffSnapshots(gcDoc, nil, nil); err != ErrGCEnabled {
+		t.Errorf("expected ErrGCEnabled, got %v", err)
+	}
+}
+
+func TestDiffSnapshotsTransaction(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	text.Insert(0, "hello", nil)
+	prev := NewSnapshotByDoc(doc)
+	text.Insert(0, "oh ", nil)
+
+	var origins []interface{}
+	doc.On("afterTransaction", NewObserverHandler(func(v ...interface{}) {
+		origins = append(origins, v[0].(*Transaction).Origin)
+	}))
+
+	// the structs end at the boundaries of the snapshots, no transaction is needed
+	diff, _ := DiffSnapshots(doc, prev, nil)
+	if changes := diff.Texts["text"]; len(changes) != 1 || changes[0].Text != "oh " {
+		t.Errorf("expected added text, got %v", changes)
+	}
+
+	if len(origins) != 0 {
+		t.Errorf("expected no transaction, got %v", origins)
+	}
+
+	// the insertion is merged with the struct of "oh ", it is split at the state of the snapshot
+	prev = NewSnapshotByDoc(doc)
+	text.Insert(3, "ah ", nil)
+	diff, _ = DiffSnapshots(doc, prev, nil)
+	if changes := diff.Texts["text"]; len(changes) != 1 || changes[0].Text != "ah " {
+		t.Errorf("expected added text, got %v", changes)
+	}
+
+	if len(origins) != 2 || origins[1] != SplitSnapshotAffectedStructsOrigin {
+		t.Errorf("expected transaction of the split, got %v", origins)
+	}
+}
+
+func TestVersionHistoryDiff(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	history, err := NewVersionHistory(doc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc.GetText("text").Insert(0, "a", nil)
+	v1, _ := history.Capture("v1", "alice")
+	doc.GetText("text").Insert(1, "b", nil)
+	v2, _ := history.Capture("v2", "alice")
+
+	diff, err := history.Diff(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths := diff.Paths(); len(paths) != 1 || paths[0] != "text" {
+		t.Errorf("expected only the text to be changed, got %v", paths)
+	}
+}
@@ -0,0 +1,266 @@
+package y_crdt
+
+import (
+	"bytes"
+	"errors"
+)
+
+var ErrUnknownDoc = errors.New("unknown doc")
+
+// EncodeDocMessage prefixes a sync or awareness message with the guid of its doc, so that the messages of several
+// docs can share one connection.
+//
+// Construction of a message:
+// [guid : varString, messageType : varUint, message definition..]
+func EncodeDocMessage(guid string, message []byte) []byte {
+	encoder := NewEncoder()
+	_ = WriteString(encoder, guid)
+	encoder.Write(message)
+	return encoder.Bytes()
+}
+
+// DecodeDocMessage splits a message of EncodeDocMessage into the guid and the message of the doc.
+func DecodeDocMessage(message []byte) (string, []byte, error) {
+	decoder := bytes.NewBuffer(message)
+	guid, err := ReadString(decoder)
+	if err != nil {
+		return "", nil, ErrInvalidData
+	}
+
+	return guid, decoder.Bytes(), nil
+}
+
+// SubdocSync syncs a doc and its loaded subdocs over one connection, e.g. a workspace whose pages are subdocs.
+// Every doc runs its own SyncStep1/SyncStep2 exchange, its messages are prefixed by EncodeDocMessage.
+//
+// A subdoc is synced once it is loaded: by Doc.Load, by autoLoad, or because it was created locally. Messages of
+// a subdoc that isn't loaded are dropped, unless LoadOnRequest is set, which lets a server load the subdocs that a
+// client requests.
+//
+// A SubdocSync is not safe for concurrent use, it must be used while the docs are locked.
+type SubdocSync struct {
+	Root          *Doc
+	LoadOnRequest bool
+
+	send      func(message []byte)
+	docs      map[string]*Doc
+	synced    Set // guids whose SyncStep1 was received
+	awareness map[string]*Awareness
+	handlers  map[*Doc][]*ObserverHandler
+	stops     []func()
+}
+
+// NewSubdocSync starts to sync root, send delivers a message to the remote side.
+func NewSubdocSync(root *Doc, send func(message []byte)) *SubdocSync {
+	m := &SubdocSync{
+		Root:      root,
+		send:      send,
+		docs:      make(map[string]*Doc),
+		synced:    NewSet(),
+		awareness: make(map[string]*Awareness),
+		handlers:  make(map[*Doc][]*ObserverHandler),
+	}
+
+	m.register(root)
+	return m
+}
+
+// Docs returns the synced docs by guid.
+func (m *SubdocSync) Docs() map[string]*Doc {
+	docs := make(map[string]*Doc, len(m.docs))
+	for guid, doc := range m.docs {
+		docs[guid] = doc
+	}
+	return docs
+}
+
+// AddAwareness syncs the awareness of one of the docs.
+func (m *SubdocSync) AddAwareness(awareness *Awareness) {
+	guid := awareness.Doc.Guid
+	m.awareness[guid] = awareness
+
+	handler := NewObserverHandler(func(v ...interface{}) {
+		if v[1] == m {
+			return
+		}
+
+		obj := v[0].(Object)
+		clients := append(obj["added"].([]Number), obj["updated"].([]Number)...)
+		clients = append(clients, obj["removed"].([]Number)...)
+		m.sendAwareness(guid, awareness, clients)
+	})
+	awareness.On("update", handler)
+	m.stops = append(m.stops, func() {
+		awareness.Off("update", handler)
+	})
+
+	if states := awareness.GetStates(); len(states) > 0 {
+		m.sendAwareness(guid, awareness, AwarenessStatesKeys(states))
+	}
+}
+
+// Receive handles a message of the remote side.
+func (m *SubdocSync) Receive(message []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrInvalidData
+		}
+	}()
+
+	guid, message, err := DecodeDocMessage(message)
+	if err != nil {
+		return err
+	}
+
+	doc, exist := m.docs[guid]
+	if !exist {
+		doc = m.request(guid)
+		if doc == nil {
+			return nil
+		}
+	}
+
+	decoder := NewUpdateDecoderV1(message)
+	switch ReadVarUint(decoder.RestDecoder) {
+	case MessageSync:
+		encoder := NewUpdateEncoderV1()
+		WriteVarUint(encoder.RestEncoder, MessageSync)
+		if ReadSyncMessage(decoder, encoder, doc, m) == MessageYjsSyncStep1 {
+			m.send(EncodeDocMessage(guid, encoder.ToUint8Array()))
+
+			// the remote side may have dropped our SyncStep1 because it loaded the doc later
+			if !m.synced.Has(guid) {
+				m.synced.Add(guid)
+				m.sendSyncStep1(doc)
+			}
+		}
+	case MessageAwareness:
+		update, err := ReadVarUint8Array(decoder.RestDecoder)
+		if err != nil {
+			return err
+		}
+
+		if awareness, exist := m.awareness[guid]; exist {
+			_, err = ApplyAwarenessUpdateWithOptions(awareness, update.([]byte), &AwarenessUpdateOptions{Origin: m})
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close stops to sync the docs.
+func (m *SubdocSync) Close() {
+	for doc := range m.handlers {
+		m.unregister(doc)
+	}
+
+	for _, stop := range m.stops {
+		stop()
+	}
+	m.stops = nil
+}
+
+func (m *SubdocSync) register(doc *Doc) {
+	if _, exist := m.handlers[doc]; exist {
+		return
+	}
+
+	update := NewObserverHandler(func(v ...interface{}) {
+		if v[1] == m {
+			return
+		}
+
+		encoder := NewUpdateEncoderV1()
+		WriteVarUint(encoder.RestEncoder, MessageSync)
+		WriteUpdate(encoder, v[0].([]byte))
+		m.send(EncodeDocMessage(doc.Guid, encoder.ToUint8Array()))
+	})
+
+	subdocs := NewObserverHandler(func(v ...interface{}) {
+		obj := v[0].(Object)
+		for subdoc := range obj["removed"].(Set) {
+			m.unregister(subdoc.(*Doc))
+		}
+
+		for subdoc := range obj["loaded"].(Set) {
+			m.register(subdoc.(*Doc))
+		}
+	})
+
+	destroy := NewObserverHandler(func(v ...interface{}) {
+		m.unregister(doc)
+	})
+
+	doc.On("update", update)
+	doc.On("subdocs", subdocs)
+	doc.On("destroy", destroy)
+	m.handlers[doc] = []*ObserverHandler{update, subdocs, destroy}
+	m.docs[doc.Guid] = doc
+
+	// subdocs that were loaded before
+	for subdoc := range doc.SubDocs {
+		if subdoc.(*Doc).ShouldLoad {
+			m.register(subdoc.(*Doc))
+		}
+	}
+
+	m.sendSyncStep1(doc)
+}
+
+func (m *SubdocSync) unregister(doc *Doc) {
+	handlers, exist := m.handlers[doc]
+	if !exist {
+		return
+	}
+
+	doc.Off("update", handlers[0])
+	doc.Off("subdocs", handlers[1])
+	doc.Off("destroy", handlers[2])
+	delete(m.handlers, doc)
+
+	if m.docs[doc.Guid] == doc {
+		delete(m.docs, doc.Guid)
+		m.synced.Delete(doc.Guid)
+	}
+}
+
+// request returns the subdoc guid that the remote side wants to sync, nil if it isn't loaded here.
+func (m *SubdocSync) request(guid string) *Doc {
+	for doc := range m.handlers {
+		for subdoc := range doc.SubDocs {
+			subdoc := subdoc.(*Doc)
+			if subdoc.Guid != guid {
+				continue
+			}
+
+			if !subdoc.ShouldLoad {
+				if !m.LoadOnRequest {
+					return nil
+				}
+
+				// the subdocs event of the parent registers the subdoc
+				subdoc.Load()
+			}
+
+			m.register(subdoc)
+			return subdoc
+		}
+	}
+
+	return nil
+}
+
+func (m *SubdocSync) sendSyncStep1(doc *Doc) {
+	encoder := NewUpdateEncoderV1()
+	WriteVarUint(encoder.RestEncoder, MessageSync)
+	WriteSyncStep1(encoder, doc)
+	m.send(EncodeDocMessage(doc.Guid, encoder.ToUint8Array()))
+}
+
+func (m *SubdocSync) sendAwareness(guid string, awareness *Awareness, clients []Number) {
+	encoder := NewEncoder()
+	WriteVarUint(encoder, MessageAwareness)
+	WriteVarUint8Array(encoder, EncodeAwarenessUpdate(awareness, clients, nil))
+	m.send(EncodeDocMessage(guid, encoder.Bytes()))
+}
@@ -0,0 +1,129 @@
+package y_crdt
+
+import (
+	"testing"
+)
+
+// testPipe delivers the messages of two SubdocSyncs to each other.
+type testPipe struct {
+	queue []func()
+}
+
+func (p *testPipe) connect(a, b *Doc) (*SubdocSync, *SubdocSync) {
+	var syncA, syncB *SubdocSync
+	deliver := func(to **SubdocSync) func([]byte) {
+		return func(message []byte) {
+			p.queue = append(p.queue, func() {
+				if err := (*to).Receive(message); err != nil {
+					panic(err)
+				}
+			})
+		}
+	}
+
+	syncA = NewSubdocSync(a, deliver(&syncB))
+	syncB = NewSubdocSync(b, deliver(&syncA))
+	p.flush()
+	return syncA, syncB
+}
+
+func (p *testPipe) flush() {
+	for len(p.queue) > 0 {
+		f := p.queue[0]
+		p.queue = p.queue[1:]
+		f()
+	}
+}
+
+func TestSubdocSync(t *testing.T) {
+	server := NewDoc("workspace", true, DefaultGCFilter, nil, false)
+	pages := server.GetMap("pages").(*YMap)
+	for _, guid := range []string{"page-1", "page-2"} {
+		page := NewDoc(guid, true, DefaultGCFilter, nil, false)
+		pages.Set(guid, page)
+		page.GetText("content").Insert(0, "content of "+guid, nil)
+	}
+
+	client := NewDoc("workspace", true, DefaultGCFilter, nil, false)
+	pipe := &testPipe{}
+	serverSync, clientSync := pipe.connect(server, client)
+	serverSync.LoadOnRequest = true
+	defer serverSync.Close()
+	defer clientSync.Close()
+
+	// the tree is synced, but the subdocs are not loaded by the client
+	page1 := client.GetMap("pages").(*YMap).Get("page-1").(*Doc)
+	if page1.ShouldLoad || page1.GetText("content").ToString() != "" {
+		t.Fatalf("expected unloaded subdoc")
+	}
+
+	if _, exist := clientSync.Docs()["page-1"]; exist {
+		t.Errorf("expected unloaded subdoc not to be synced")
+	}
+
+	page1.Load()
+	pipe.flush()
+	if s := page1.GetText("content").ToString(); s != "content of page-1" {
+		t.Fatalf("expected loaded subdoc to be synced, got %s", s)
+	}
+
+	// updates of loaded subdocs are sent in both directions
+	page1.GetText("content").Insert(0, "new ", nil)
+	pipe.flush()
+	serverPage1 := pages.Get("page-1").(*Doc)
+	if s := serverPage1.GetText("content").ToString(); s != "new content of page-1" {
+		t.Errorf("expected update of client, got %s", s)
+	}
+
+	serverPage1.GetText("content").Insert(0, "the ", nil)
+	pipe.flush()
+	if s := page1.GetText("content").ToString(); s != "the new content of page-1" {
+		t.Errorf("expected update of server, got %s", s)
+	}
+
+	// the client doesn't sync subdocs it didn't load
+	pages.Get("page-2").(*Doc).GetText("content").Insert(0, "x", nil)
+	pipe.flush()
+	if client.GetMap("pages").(*YMap).Get("page-2").(*Doc).GetText("content").ToString() != "" {
+		t.Errorf("expected unloaded subdoc not to be synced")
+	}
+
+	// nested subdocs are synced after they are loaded
+	nested := NewDoc("nested", true, DefaultGCFilter, nil, true)
+	page1.GetMap("children").(*YMap).Set("nested", nested)
+	nested.GetArray("items").Insert(0, ArrayAny{1, 2, 3})
+	pipe.flush()
+	serverNested := serverPage1.GetMap("children").(*YMap).Get("nested").(*Doc)
+	if serverNested.GetArray("items").GetLength() != 3 {
+		t.Errorf("expected nested subdoc with autoLoad to be synced")
+	}
+
+	// awareness is synced per doc
+	clientAwareness := NewAwarenessWithClock(page1, &fakeClock{})
+	serverAwareness := NewAwarenessWithClock(serverPage1, &fakeClock{})
+	serverSync.AddAwareness(serverAwareness)
+	clientSync.AddAwareness(clientAwareness)
+	clientAwareness.SetLocalState(Object{"name": "alice"})
+	pipe.flush()
+	if state := serverAwareness.GetStates()[clientAwareness.ClientID]; state == nil || state["name"] != "alice" {
+		t.Errorf("expected awareness of page-1 to be synced, got %v", state)
+	}
+
+	// a deleted subdoc isn't synced anymore
+	pages.Delete("page-1")
+	pipe.flush()
+	if _, exist := clientSync.Docs()["page-1"]; exist {
+		t.Errorf("expected deleted subdoc not to be synced")
+	}
+}
+
+func TestDocMessage(t *testing.T) {
+	guid, message, err := DecodeDocMessage(EncodeDocMessage("page", []byte{MessageSync, 1, 2}))
+	if err != nil || guid != "page" || len(message) != 3 || message[2] != 2 {
+		t.Errorf("expected message of page, got %s %v %v", guid, message, err)
+	}
+
+	if _, _, err = DecodeDocMessage([]byte{5, 'a'}); err != ErrInvalidData {
+		t.Errorf("expected invalid data, got %v", err)
+	}
+}
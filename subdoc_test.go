@@ -0,0 +1,124 @@
+package y_crdt
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+// subdocsUpdate is encoded as Yjs encodes:
+//
+//	```js
+//	   const doc = new Y.Doc()
+//	   doc.clientID = 1
+//	   const folder = doc.getMap('folder')
+//	   folder.set('a', new Y.Doc({ guid: 'sub-a' }))
+//	   folder.set('b', new Y.Doc({ guid: 'sub-b', autoLoad: true }))
+//	   const update = Y.encodeStateAsUpdate(doc)
+//	```
+var subdocsUpdate = []byte{
+	1,       // 1 client
+	2, 1, 0, // 2 structs of client 1, starting at clock 0
+	41, 1, 6, 'f', 'o', 'l', 'd', 'e', 'r', 1, 'a', // ContentDoc with parent sub "a" in root type "folder"
+	5, 's', 'u', 'b', '-', 'a', 118, 0, // guid "sub-a", opts {}
+	41, 1, 6, 'f', 'o', 'l', 'd', 'e', 'r', 1, 'b', // ContentDoc with parent sub "b" in root type "folder"
+	5, 's', 'u', 'b', '-', 'b', 118, 1, 8, 'a', 'u', 't', 'o', 'L', 'o', 'a', 'd', 120, // guid "sub-b", opts {autoLoad: true}
+	0, // empty delete set
+}
+
+func subdocGuids(v interface{}) []string {
+	var guids []string
+	for subdoc := range v.(Set) {
+		guids = append(guids, subdoc.(*Doc).Guid)
+	}
+	sort.Strings(guids)
+	return guids
+}
+
+func TestSubdocs(t *testing.T) {
+	doc := NewDoc("root", true, DefaultGCFilter, nil, false)
+	var events []Object
+	doc.On("subdocs", NewObserverHandler(func(v ...interface{}) {
+		events = append(events, v[0].(Object))
+	}))
+
+	ApplyUpdate(doc, subdocsUpdate, nil)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 subdocs event, got %d", len(events))
+	}
+
+	if added := subdocGuids(events[0]["added"]); len(added) != 2 || added[0] != "sub-a" || added[1] != "sub-b" {
+		t.Errorf("expected sub-a and sub-b to be added, got %v", added)
+	}
+
+	// only the subdoc with autoLoad is loaded
+	if loaded := subdocGuids(events[0]["loaded"]); len(loaded) != 1 || loaded[0] != "sub-b" {
+		t.Errorf("expected sub-b to be loaded, got %v", loaded)
+	}
+
+	guids := doc.GetSubdocGuids()
+	if len(guids) != 2 || !guids.Has("sub-a") || !guids.Has("sub-b") {
+		t.Errorf("expected subdocs to be registered, got %v", guids)
+	}
+
+	folder := doc.GetMap("folder").(*YMap)
+	a := folder.Get("a").(*Doc)
+	if a.Item == nil || a.ShouldLoad || a.ClientID != doc.ClientID {
+		t.Errorf("expected unloaded subdoc linked to its item")
+	}
+
+	a.Load()
+	if len(events) != 2 || !a.ShouldLoad {
+		t.Fatalf("expected subdocs event of load, got %d events", len(events))
+	}
+
+	if loaded := subdocGuids(events[1]["loaded"]); len(loaded) != 1 || loaded[0] != "sub-a" || len(events[1]["added"].(Set)) != 0 {
+		t.Errorf("expected sub-a to be loaded, got %v", loaded)
+	}
+
+	// loading twice has no effect
+	a.Load()
+	if len(events) != 2 {
+		t.Errorf("expected no event for a loaded subdoc")
+	}
+
+	// a deleted subdoc is removed and destroyed
+	destroyed := false
+	a.On("destroy", NewObserverHandler(func(v ...interface{}) {
+		destroyed = true
+	}))
+
+	folder.Delete("a")
+	if len(events) < 3 || !destroyed || doc.GetSubdocGuids().Has("sub-a") {
+		t.Fatalf("expected sub-a to be removed and destroyed")
+	}
+
+	if removed := subdocGuids(events[2]["removed"]); len(removed) != 1 || removed[0] != "sub-a" {
+		t.Errorf("expected sub-a to be removed, got %v", removed)
+	}
+
+	// a destroyed subdoc is replaced by an unloaded instance
+	b := folder.Get("b").(*Doc)
+	b.Destroy()
+	replaced := folder.Get("b").(*Doc)
+	if replaced == b || replaced.ShouldLoad || replaced.Item == nil || !doc.SubDocs.Has(replaced) || doc.SubDocs.Has(b) {
+		t.Errorf("expected destroyed subdoc to be replaced")
+	}
+}
+
+func TestSubdocsEncoding(t *testing.T) {
+	doc := NewDoc("root", true, DefaultGCFilter, nil, false)
+	doc.ClientID = 1
+	folder := doc.GetMap("folder").(*YMap)
+	folder.Set("a", NewDoc("sub-a", true, DefaultGCFilter, nil, false))
+	folder.Set("b", NewDoc("sub-b", true, DefaultGCFilter, nil, true))
+
+	if update := EncodeStateAsUpdate(doc, nil); !bytes.Equal(update, subdocsUpdate) {
+		t.Errorf("expected update of Yjs, got %v", update)
+	}
+
+	// locally created subdocs are loaded
+	if len(doc.SubDocs) != 2 || !folder.Get("a").(*Doc).ShouldLoad {
+		t.Errorf("expected loaded subdocs")
+	}
+}
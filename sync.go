@@ -91,3 +91,87 @@ func ReadSyncMessage(decoder *UpdateDecoderV1, encoder *UpdateEncoderV1, doc *Do
 
 	return int(messageType)
 }
+
+// SyncMessageOverhead is the maximum size of the message type and the length prefix of a sync message.
+const SyncMessageOverhead = 6
+
+// EncodeSyncStep2Messages creates the sync step 2 reply as several messages that are at most maxMessageSize bytes,
+// so that a large document can be sent through transports that limit the message size.
+//
+// Every message is a self-contained update. All messages but the last are sent as MessageYjsUpdate, the last one is
+// a MessageYjsSyncStep2, so the remote client only considers itself synced after it received all of them.
+func EncodeSyncStep2Messages(doc *Doc, encodedStateVector []byte, maxMessageSize int) ([][]byte, error) {
+	return encodeSyncStep2Messages(EncodeStateAsUpdate(doc, encodedStateVector), maxMessageSize)
+}
+
+// EncodeSyncStep2MessagesFromUpdate is EncodeSyncStep2Messages for a doc that is stored as update, e.g. by a server
+// that doesn't load the doc. The part of update that is missing for encodedStateVector is split by SplitUpdate
+// into messages of at most maxMessageSize bytes, SyncMessageOverhead included.
+func EncodeSyncStep2MessagesFromUpdate(update []byte, encodedStateVector []byte, maxMessageSize int) ([][]byte, error) {
+	return encodeSyncStep2Messages(DiffUpdate(update, encodedStateVector), maxMessageSize)
+}
+
+// EncodeUpdateMessages splits an update into MessageYjsUpdate messages that are at most maxMessageSize bytes.
+func EncodeUpdateMessages(update []byte, maxMessageSize int) ([][]byte, error) {
+	updates, err := SplitUpdate(update, maxMessageSize-SyncMessageOverhead)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([][]byte, 0, len(updates))
+	for _, u := range updates {
+		encoder := NewUpdateEncoderV1()
+		WriteUpdate(encoder, u)
+		messages = append(messages, encoder.ToUint8Array())
+	}
+
+	return messages, nil
+}
+
+func encodeSyncStep2Messages(update []byte, maxMessageSize int) ([][]byte, error) {
+	updates, err := SplitUpdate(update, maxMessageSize-SyncMessageOverhead)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([][]byte, 0, len(updates))
+	for i, u := range updates {
+		encoder := NewUpdateEncoderV1()
+		if i == len(updates)-1 {
+			WriteVarUint(encoder.RestEncoder, MessageYjsSyncStep2)
+			WriteVarUint8Array(encoder.RestEncoder, u)
+		} else {
+			WriteUpdate(encoder, u)
+		}
+		messages = append(messages, encoder.ToUint8Array())
+	}
+
+	return messages, nil
+}
+
+// ReadSyncMessageChunked works like ReadSyncMessage, but replies to SyncStep1 with messages that are at most
+// maxMessageSize bytes.
+func ReadSyncMessageChunked(decoder *UpdateDecoderV1, doc *Doc, transactionOrigin interface{}, maxMessageSize int) ([][]byte, int) {
+	messageType := ReadVarUint(decoder.RestDecoder)
+	switch messageType {
+	case MessageYjsSyncStep1:
+		data, err := ReadVarUint8Array(decoder.RestDecoder)
+		if err != nil {
+			Logf("[protocol] read sync step1 failed. err:%s", err.Error())
+			return nil, int(messageType)
+		}
+
+		messages, err := EncodeSyncStep2Messages(doc, data.([]byte), maxMessageSize)
+		if err != nil {
+			Logf("[protocol] encode sync step2 failed. err:%s", err.Error())
+			return nil, int(messageType)
+		}
+		return messages, int(messageType)
+	case MessageYjsSyncStep2, MessageYjsUpdate:
+		ReadSyncStep2(decoder, doc, transactionOrigin)
+	default:
+
+	}
+
+	return nil, int(messageType)
+}
@@ -0,0 +1,255 @@
+package y_crdt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPollTimeout    = 25 * time.Second
+	DefaultSessionTimeout = 60 * time.Second
+	DefaultMaxBodySize    = 32 << 20
+
+	// HeaderSyncCursor is the response header of a long-poll that holds the cursor of the client.
+	HeaderSyncCursor = "X-Yjs-Cursor"
+)
+
+// SyncHTTPHandler serves a SyncHub over plain http for clients that can't use websockets.
+//
+// Every request identifies its session by the query parameter "session", an unknown session is connected with
+// the query parameter "cursor" or the header "Last-Event-ID" as cursor. Cursors are base64 url encoded.
+//
+//	POST ?session=id          the body holds messages of the client, each as var uint8 array
+//	GET  ?session=id          long-poll, the body holds the queued messages, each as var uint8 array,
+//	                          and the header X-Yjs-Cursor the cursor after the messages
+//	GET  ?session=id          with "Accept: text/event-stream", server-sent events with a base64 encoded message
+//	                          as data and the cursor as id, so that EventSource reconnects with its cursor
+type SyncHTTPHandler struct {
+	Hub *SyncHub
+
+	// Identify returns the comparable identity of the client of a request, which is passed to the write policy
+	// of the doc. The session id is used if it is nil.
+	Identify func(r *http.Request) interface{}
+
+	PollTimeout    time.Duration // maximum duration of a long-poll, DefaultPollTimeout if zero
+	SessionTimeout time.Duration // long-poll sessions are closed after this idle time, DefaultSessionTimeout if zero
+
+	// MaxBodySize limits the body of a POST, DefaultMaxBodySize if zero. It must fit the SyncStep2 of a client
+	// with offline changes, which is never split.
+	MaxBodySize int64
+}
+
+func NewSyncHTTPHandler(hub *SyncHub) *SyncHTTPHandler {
+	return &SyncHTTPHandler{Hub: hub}
+}
+
+func (h *SyncHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Hub.ExpireSessions(h.sessionTimeout())
+
+	s, err := h.session(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost:
+		h.receive(w, r, s)
+	case r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/event-stream"):
+		h.stream(w, r, s)
+	case r.Method == http.MethodGet:
+		h.poll(w, r, s)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// EncodeSyncCursor encodes the cursor of a client for the query parameter "cursor".
+func EncodeSyncCursor(cursor []byte) string {
+	return base64.URLEncoding.EncodeToString(cursor)
+}
+
+func DecodeSyncCursor(cursor string) ([]byte, error) {
+	return base64.URLEncoding.DecodeString(cursor)
+}
+
+// ReadSyncMessages splits a body of var uint8 arrays into messages.
+func ReadSyncMessages(body []byte) ([][]byte, error) {
+	var messages [][]byte
+	decoder := bytes.NewBuffer(body)
+	for decoder.Len() > 0 {
+		message, err := ReadVarUint8Array(decoder)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message.([]byte))
+	}
+
+	return messages, nil
+}
+
+// WriteSyncMessages joins messages into a body of var uint8 arrays.
+func WriteSyncMessages(messages [][]byte) []byte {
+	encoder := NewEncoder()
+	for _, message := range messages {
+		WriteVarUint8Array(encoder, message)
+	}
+	return encoder.Bytes()
+}
+
+func (h *SyncHTTPHandler) session(r *http.Request) (*SyncSession, error) {
+	id := r.URL.Query().Get("session")
+	if id == "" {
+		return nil, fmt.Errorf("missing session")
+	}
+
+	var conn interface{} = id
+	if h.Identify != nil {
+		conn = h.Identify(r)
+	}
+
+	if s, exist := h.Hub.Session(id); exist {
+		if s.Conn != conn {
+			return nil, fmt.Errorf("session %s belongs to another client", id)
+		}
+		return s, nil
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+
+	sv, err := DecodeSyncCursor(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor. err:%s", err.Error())
+	}
+
+	return h.Hub.Connect(id, conn, sv)
+}
+
+func (h *SyncHTTPHandler) receive(w http.ResponseWriter, r *http.Request, s *SyncSession) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize()))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages, err := ReadSyncMessages(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, message := range messages {
+		// rejected updates are answered by a permission denied message of the session
+		if err = h.Hub.Receive(s, message); err != nil {
+			Logf("[crdt] receive message of session %s failed. err:%s", s.ID, err.Error())
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *SyncHTTPHandler) poll(w http.ResponseWriter, r *http.Request, s *SyncSession) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.pollTimeout())
+	defer cancel()
+
+	if err := s.Wait(ctx); err == ErrSessionClosed {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	if r.Context().Err() != nil {
+		// the client went away, the queued messages stay for its next poll
+		return
+	}
+
+	messages, cursor := h.Hub.Drain(s)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(HeaderSyncCursor, EncodeSyncCursor(cursor))
+	_, _ = w.Write(WriteSyncMessages(messages))
+}
+
+func (h *SyncHTTPHandler) stream(w http.ResponseWriter, r *http.Request, s *SyncSession) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// the stream is the connection of the client, EventSource reconnects by its cursor
+	defer h.Hub.Disconnect(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), h.pollTimeout())
+		err := s.Wait(ctx)
+		cancel()
+		if err == ErrSessionClosed || r.Context().Err() != nil {
+			return
+		}
+
+		messages, cursor := h.Hub.Drain(s)
+		if len(messages) == 0 {
+			// keep the connection and the session alive
+			if _, err = io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+
+		for i, message := range messages {
+			// only the last message completes the cursor, a client that reconnects after a part of the
+			// messages keeps its previous cursor
+			if i == len(messages)-1 {
+				_, err = fmt.Fprintf(w, "id: %s\n", EncodeSyncCursor(cursor))
+			}
+
+			if err == nil {
+				_, err = fmt.Fprintf(w, "data: %s\n\n", base64.StdEncoding.EncodeToString(message))
+			}
+
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *SyncHTTPHandler) pollTimeout() time.Duration {
+	if h.PollTimeout > 0 {
+		return h.PollTimeout
+	}
+	return DefaultPollTimeout
+}
+
+func (h *SyncHTTPHandler) maxBodySize() int64 {
+	if h.MaxBodySize > 0 {
+		return h.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+func (h *SyncHTTPHandler) sessionTimeout() time.Duration {
+	if h.SessionTimeout > 0 {
+		return h.SessionTimeout
+	}
+	return DefaultSessionTimeout
+}
@@ -0,0 +1,232 @@
+package y_crdt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testHTTPClient syncs a doc with a SyncHTTPHandler by long-polling.
+type testHTTPClient struct {
+	t       *testing.T
+	url     string
+	session string
+	doc     *Doc
+	cursor  string
+}
+
+func newTestHTTPClient(t *testing.T, url, session string) *testHTTPClient {
+	c := &testHTTPClient{t: t, url: url, session: session, doc: NewDoc("doc", true, DefaultGCFilter, nil, false)}
+	c.doc.On("update", NewObserverHandler(func(v ...interface{}) {
+		if v[1] == "server" {
+			return
+		}
+
+		encoder := NewUpdateEncoderV1()
+		WriteVarUint(encoder.RestEncoder, MessageSync)
+		WriteUpdate(encoder, v[0].([]byte))
+		c.post(encoder.ToUint8Array())
+	}))
+	return c
+}
+
+func (c *testHTTPClient) post(messages ...[]byte) {
+	resp, err := http.Post(c.url+"?session="+c.session, "application/octet-stream", bytes.NewReader(WriteSyncMessages(messages)))
+	if err != nil {
+		c.t.Fatalf("post failed. err:%s", err.Error())
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		c.t.Fatalf("expected status accepted, got %d", resp.StatusCode)
+	}
+}
+
+// poll receives and applies the queued messages, it returns the received messages.
+func (c *testHTTPClient) poll() [][]byte {
+	resp, err := http.Get(c.url + "?session=" + c.session + "&cursor=" + c.cursor)
+	if err != nil {
+		c.t.Fatalf("poll failed. err:%s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	messages, err := ReadSyncMessages(body)
+	if err != nil {
+		c.t.Fatalf("read messages failed. err:%s", err.Error())
+	}
+
+	c.cursor = resp.Header.Get(HeaderSyncCursor)
+	for _, message := range messages {
+		c.apply(message)
+	}
+	return messages
+}
+
+func (c *testHTTPClient) apply(message []byte) {
+	decoder := NewUpdateDecoderV1(message)
+	if ReadVarUint(decoder.RestDecoder) != MessageSync {
+		return
+	}
+
+	encoder := NewUpdateEncoderV1()
+	WriteVarUint(encoder.RestEncoder, MessageSync)
+	if ReadSyncMessage(decoder, encoder, c.doc, "server") == MessageYjsSyncStep1 {
+		c.post(encoder.ToUint8Array())
+	}
+}
+
+func TestSyncHTTPLongPoll(t *testing.T) {
+	hub := NewSyncHub("doc")
+	defer hub.Close()
+	hub.Doc.GetText("text").Insert(0, "server", nil)
+
+	handler := NewSyncHTTPHandler(hub)
+	handler.PollTimeout = 50 * time.Millisecond
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	a := newTestHTTPClient(t, server.URL, "a")
+	a.poll()
+	if a.doc.GetText("text").ToString() != "server" {
+		t.Fatalf("expected initial content, got %s", a.doc.GetText("text").ToString())
+	}
+
+	b := newTestHTTPClient(t, server.URL, "b")
+	b.poll()
+
+	a.doc.GetText("text").Insert(0, "a ", nil)
+	b.poll()
+	if b.doc.GetText("text").ToString() != "a server" {
+		t.Errorf("expected update of a, got %s", b.doc.GetText("text").ToString())
+	}
+
+	// the sender doesn't receive its own update
+	if messages := a.poll(); len(messages) != 0 {
+		t.Errorf("expected no messages, got %d", len(messages))
+	}
+
+	// a reconnecting client only receives the missing updates
+	session, _ := hub.Session("b")
+	hub.Disconnect(session)
+	a.doc.GetText("text").Insert(0, "again ", nil)
+
+	b.session = "b2"
+	for _, message := range b.poll() {
+		if bytes.Contains(message, []byte("server")) {
+			t.Errorf("expected only missing updates after reconnect")
+		}
+	}
+
+	if b.doc.GetText("text").ToString() != "again a server" {
+		t.Errorf("expected reconnected client to converge, got %s", b.doc.GetText("text").ToString())
+	}
+}
+
+func TestSyncHTTPMaxBodySize(t *testing.T) {
+	hub := NewSyncHub("doc")
+	defer hub.Close()
+	handler := NewSyncHTTPHandler(hub)
+	handler.MaxBodySize = 64
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	c := newTestHTTPClient(t, server.URL, "a")
+	c.doc.GetText("text").Insert(0, "small", nil)
+
+	resp, err := http.Post(server.URL+"?session=a", "application/octet-stream", bytes.NewReader(WriteSyncMessages([][]byte{make([]byte, 128)})))
+	if err != nil {
+		t.Fatalf("post failed. err:%s", err.Error())
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status request entity too large, got %d", resp.StatusCode)
+	}
+
+	if hub.Doc.GetText("text").ToString() != "small" {
+		t.Errorf("expected small update to be applied, got %s", hub.Doc.GetText("text").ToString())
+	}
+}
+
+func TestSyncHTTPPollCancelled(t *testing.T) {
+	hub := NewSyncHub("doc")
+	defer hub.Close()
+	handler := NewSyncHTTPHandler(hub)
+
+	// the session is connected with the initial SyncStep1 and SyncStep2 queued
+	s, err := hub.Connect("a", "a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?session=a", nil).WithContext(ctx))
+
+	if messages, _ := hub.Drain(s); len(messages) == 0 {
+		t.Errorf("expected the messages to stay queued for a client that went away")
+	}
+}
+
+func TestSyncHTTPEventStream(t *testing.T) {
+	hub := NewSyncHub("doc")
+	defer hub.Close()
+	hub.Doc.GetText("text").Insert(0, "server", nil)
+
+	server := httptest.NewServer(NewSyncHTTPHandler(hub))
+	defer server.Close()
+
+	c := newTestHTTPClient(t, server.URL, "c")
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"?session=c", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open event stream failed. err:%s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+		close(events)
+	}()
+
+	waitFor := func(expected string) {
+		deadline := time.After(5 * time.Second)
+		for c.doc.GetText("text").ToString() != expected {
+			select {
+			case data := <-events:
+				message, _ := base64.StdEncoding.DecodeString(data)
+				c.apply(message)
+			case <-deadline:
+				t.Fatalf("expected %s, got %s", expected, c.doc.GetText("text").ToString())
+			}
+		}
+	}
+
+	waitFor("server")
+
+	other := newTestHTTPClient(t, server.URL, "other")
+	other.poll()
+	other.doc.GetText("text").Insert(6, "!", nil)
+	waitFor("server!")
+
+	c.doc.GetText("text").Insert(0, "c ", nil)
+	other.poll()
+	if other.doc.GetText("text").ToString() != "c server!" {
+		t.Errorf("expected update of stream client, got %s", other.doc.GetText("text").ToString())
+	}
+}
@@ -0,0 +1,303 @@
+package y_crdt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrSessionClosed = errors.New("sync session closed")
+
+// SyncHub shares a doc with the sessions of its clients independent of the transport. A transport passes the
+// messages of a client to Receive and delivers the messages that are queued for the session, e.g. by websocket,
+// long-polling or server-sent events.
+//
+// The doc is only accessed while the hub is locked, so the hub is safe for concurrent use.
+type SyncHub struct {
+	Doc *WSSharedDoc
+
+	mutex    sync.Mutex
+	sessions map[string]*SyncSession
+	current  *SyncSession // the session whose message is handled, it doesn't receive its own update
+}
+
+// SyncSession is the connection of a client to a SyncHub.
+type SyncSession struct {
+	ID   string
+	Conn interface{} // identity of the client, passed to the write policy of the doc
+
+	mutex     sync.Mutex
+	messages  [][]byte
+	wake      chan struct{}
+	closed    bool
+	lastSeen  time.Time
+	awareness Set // awareness clients controlled by the session
+}
+
+func NewSyncHub(docID string) *SyncHub {
+	h := &SyncHub{
+		sessions: make(map[string]*SyncSession),
+	}
+
+	h.Doc = NewWSSharedDocWithClock(docID, h.broadcast, h.broadcast, LockedClock{SystemClock, &h.mutex})
+	h.Doc.Awareness.On("update", NewObserverHandler(func(v ...interface{}) {
+		s, ok := v[1].(*SyncSession)
+		if !ok {
+			return
+		}
+
+		obj := v[0].(Object)
+		for _, clients := range [][]Number{obj["added"].([]Number), obj["updated"].([]Number)} {
+			for _, client := range clients {
+				s.awareness.Add(client)
+			}
+		}
+
+		for _, client := range obj["removed"].([]Number) {
+			s.awareness.Delete(client)
+		}
+	}))
+
+	return h
+}
+
+// Connect creates the session id of a client. cursor is the encoded state vector the client already knows,
+// e.g. the cursor of a previous session, nil if it knows nothing.
+//
+// The ConnectHooks of the doc may refuse the client. The session starts with the missing part of the doc, a sync
+// step 1 so that the client replies with its changes, and the awareness states.
+func (h *SyncHub) Connect(id string, conn interface{}, cursor []byte) (*SyncSession, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if s, exist := h.sessions[id]; exist {
+		h.disconnect(s)
+	}
+
+	s := &SyncSession{
+		ID:        id,
+		Conn:      conn,
+		wake:      make(chan struct{}, 1),
+		lastSeen:  time.Now(),
+		awareness: NewSet(),
+	}
+
+	messages, err := h.Doc.SyncStep2Messages(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.Doc.Connect(conn); err != nil {
+		return nil, err
+	}
+
+	encoder := NewUpdateEncoderV1()
+	WriteVarUint(encoder.RestEncoder, MessageSync)
+	WriteSyncStep1(encoder, h.Doc.Doc)
+	messages = append(messages, encoder.ToUint8Array())
+
+	if states := h.Doc.Awareness.GetStates(); len(states) > 0 {
+		encoder := NewEncoder()
+		WriteVarUint(encoder, MessageAwareness)
+		WriteVarUint8Array(encoder, EncodeAwarenessUpdate(h.Doc.Awareness, AwarenessStatesKeys(states), nil))
+		messages = append(messages, encoder.Bytes())
+	}
+
+	s.Send(messages...)
+	h.sessions[id] = s
+	return s, nil
+}
+
+// Session returns the connected session id.
+func (h *SyncHub) Session(id string) (*SyncSession, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s, exist := h.sessions[id]
+	return s, exist
+}
+
+// Receive handles a message of the client of s. Replies, e.g. a permission denied message, are queued to s.
+func (h *SyncHub) Receive(s *SyncSession, message []byte) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if s.isClosed() {
+		return ErrSessionClosed
+	}
+
+	s.touch()
+	h.current = s
+	defer func() {
+		h.current = nil
+	}()
+
+	decoder := NewUpdateDecoderV1(message)
+	switch ReadVarUint(decoder.RestDecoder) {
+	case MessageSync:
+		replies, err := h.Doc.ReadSyncMessage(decoder, s.Conn)
+		s.Send(replies...)
+		return err
+	case MessageAwareness:
+		update, err := ReadVarUint8Array(decoder.RestDecoder)
+		if err != nil {
+			return err
+		}
+
+		_, err = ApplyAwarenessUpdateWithOptions(h.Doc.Awareness, update.([]byte), &AwarenessUpdateOptions{Origin: s})
+		return err
+	default:
+		return ErrInvalidData
+	}
+}
+
+// Drain returns the queued messages of s and the cursor of the client after it received them.
+func (h *SyncHub) Drain(s *SyncSession) ([][]byte, []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s.touch()
+	return s.drain(), EncodeStateVector(h.Doc.Doc, nil, NewUpdateEncoderV1())
+}
+
+// Disconnect closes s and removes the awareness states of its client.
+func (h *SyncHub) Disconnect(s *SyncSession) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.disconnect(s)
+}
+
+// ExpireSessions disconnects the sessions that were not used for timeout, e.g. long-polling clients that are gone.
+func (h *SyncHub) ExpireSessions(timeout time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, s := range h.sessions {
+		s.mutex.Lock()
+		expired := time.Since(s.lastSeen) > timeout
+		s.mutex.Unlock()
+
+		if expired {
+			h.disconnect(s)
+		}
+	}
+}
+
+// Close disconnects all sessions and destroys the doc.
+func (h *SyncHub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, s := range h.sessions {
+		h.disconnect(s)
+	}
+	h.Doc.Destroy()
+}
+
+func (h *SyncHub) disconnect(s *SyncSession) {
+	if s.isClosed() {
+		return
+	}
+
+	if h.sessions[s.ID] == s {
+		delete(h.sessions, s.ID)
+	}
+
+	var clients []Number
+	for client := range s.awareness {
+		clients = append(clients, client.(Number))
+	}
+	RemoveAwarenessStates(h.Doc.Awareness, clients, nil)
+
+	s.close()
+	h.Doc.Disconnect(s.Conn)
+}
+
+func (h *SyncHub) broadcast(message []byte) {
+	for _, s := range h.sessions {
+		if s != h.current {
+			s.Send(message)
+		}
+	}
+}
+
+// Send queues messages for the client.
+func (s *SyncSession) Send(messages ...[]byte) {
+	if len(messages) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.messages = append(s.messages, messages...)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Wait blocks until messages are queued for the client or ctx is done.
+func (s *SyncSession) Wait(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrSessionClosed
+	}
+
+	if len(s.messages) > 0 {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-s.wake:
+		if s.isClosed() {
+			return ErrSessionClosed
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *SyncSession) drain() [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages := s.messages
+	s.messages = nil
+	return messages
+}
+
+func (s *SyncSession) touch() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastSeen = time.Now()
+}
+
+func (s *SyncSession) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		s.messages = nil
+		close(s.wake)
+	}
+}
+
+func (s *SyncSession) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
@@ -250,7 +250,7 @@ func CleanupTransactions(transactionCleanups []*Transaction, i Number) {
 		// Replace deleted items with ItemDeleted / GC.
 		// This is where content is actually remove from the Yjs Doc.
 		if doc.GC {
-			TryGcDeleteSet(ds, store, doc.GCFilter)
+			TryGcDeleteSet(ds, store, doc.collectable)
 		}
 		TryMergeDeleteSet(ds, store)
 
@@ -312,21 +312,25 @@ func CleanupTransactions(transactionCleanups []*Transaction, i Number) {
 			}
 		}
 
-		for subdoc := range trans.SubdocsAdded {
-			doc.SubDocs.Add(subdoc)
-		}
+		if len(trans.SubdocsAdded) > 0 || len(trans.SubdocsRemoved) > 0 || len(trans.SubdocsLoaded) > 0 {
+			for subdoc := range trans.SubdocsAdded {
+				subdoc.(*Doc).ClientID = doc.ClientID
+				doc.SubDocs.Add(subdoc)
+			}
 
-		for subdoc := range trans.SubdocsRemoved {
-			doc.SubDocs.Delete(subdoc)
-		}
+			for subdoc := range trans.SubdocsRemoved {
+				doc.SubDocs.Delete(subdoc)
+			}
 
-		doc.Emit("subdocs", Object{
-			"loaded":  trans.SubdocsLoaded,
-			"added":   trans.SubdocsAdded,
-			"removed": trans.SubdocsRemoved})
+			doc.Emit("subdocs", Object{
+				"loaded":  trans.SubdocsLoaded,
+				"added":   trans.SubdocsAdded,
+				"removed": trans.SubdocsRemoved,
+			}, doc, trans)
 
-		for subdoc := range trans.SubdocsRemoved {
-			subdoc.(*Doc).Destroy()
+			for subdoc := range trans.SubdocsRemoved {
+				subdoc.(*Doc).Destroy()
+			}
 		}
 
 		if len(transactionCleanups) <= i+1 {
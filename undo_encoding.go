@@ -0,0 +1,157 @@
+package y_crdt
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EncodeUndoStacks encodes the undo and the redo stack of u, e.g. to store the undo history of a user together with
+// the doc. The keys of StackItem.Meta must be strings and its values must be encodable by encoding/json.
+//
+// Construction of the stacks:
+// [undoStackLength : varUint, stackItems.., redoStackLength : varUint, stackItems..]
+//
+// Construction of a stack item:
+// [deletions : deleteSet, insertions : deleteSet, meta : varUint8Array of a JSON object]
+func EncodeUndoStacks(u *UndoManager) ([]byte, error) {
+	encoder := NewUpdateEncoderV1()
+	for _, stack := range [][]*StackItem{u.UndoStack, u.RedoStack} {
+		WriteVarUint(encoder.RestEncoder, uint64(len(stack)))
+		for _, stackItem := range stack {
+			WriteDeleteSet(encoder, stackItem.Deletions)
+			WriteDeleteSet(encoder, stackItem.Insertions)
+
+			meta := make(map[string]interface{}, len(stackItem.Meta))
+			for key, value := range stackItem.Meta {
+				name, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("meta key %v of a stack item is not a string", key)
+				}
+				meta[name] = value
+			}
+
+			data, err := json.Marshal(meta)
+			if err != nil {
+				return nil, err
+			}
+			WriteVarUint8Array(encoder.RestEncoder, data)
+		}
+	}
+
+	return encoder.ToUint8Array(), nil
+}
+
+// DecodeUndoStacks replaces the stacks of u by the stacks of EncodeUndoStacks. A selection of TrackSelection is
+// decoded as *Cursor, the other values of StackItem.Meta are decoded as by encoding/json.
+//
+// The deleted items of the stacks are kept from being garbage collected, also the items that the doc integrates
+// later. Decode the stacks before the state of a doc with GC is loaded, its deleted content is collected otherwise.
+func DecodeUndoStacks(u *UndoManager, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrInvalidData
+		}
+	}()
+
+	decoder := NewUpdateDecoderV1(data)
+	var stacks [2][]*StackItem
+	for i := range stacks {
+		n, err := readVarUint(decoder.RestDecoder)
+		if err != nil {
+			return ErrInvalidData
+		}
+
+		for j := uint64(0); j < n.(uint64); j++ {
+			stackItem, err := readStackItem(decoder)
+			if err != nil {
+				return err
+			}
+			stacks[i] = append(stacks[i], stackItem)
+		}
+	}
+
+	u.Clear()
+	u.UndoStack, u.RedoStack = stacks[0], stacks[1]
+	u.keepStacks()
+
+	u.GetDoc().Transact(func(trans *Transaction) {
+		for _, stack := range stacks {
+			for _, stackItem := range stack {
+				IterateDeletedStructs(trans, stackItem.Deletions, func(s IAbstractStruct) {
+					if item, ok := s.(*Item); ok && u.isParentOf(item) {
+						KeepItem(item, true)
+					}
+				})
+			}
+		}
+	}, u)
+
+	return nil
+}
+
+func readStackItem(decoder *UpdateDecoderV1) (*StackItem, error) {
+	deletions := ReadDeleteSet(decoder)
+	insertions := ReadDeleteSet(decoder)
+	if deletions == nil || insertions == nil {
+		return nil, ErrInvalidData
+	}
+
+	data, err := ReadVarUint8Array(decoder.RestDecoder)
+	if err != nil {
+		return nil, ErrInvalidData
+	}
+
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(data.([]byte), &meta); err != nil {
+		return nil, ErrInvalidData
+	}
+
+	stackItem := NewStackItem(deletions, insertions)
+	for key, raw := range meta {
+		var value interface{}
+		if key == MetaKeySelection {
+			value = &Cursor{}
+		}
+
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, ErrInvalidData
+		}
+		stackItem.Meta[key] = value
+	}
+
+	return stackItem, nil
+}
+
+// keepStacks keeps the deleted items of the stacks from being garbage collected, e.g. the items of decoded stacks
+// that are integrated after the stacks were decoded. The doc keeps them until u is destroyed.
+func (u *UndoManager) keepStacks() {
+	u.kept = u.stackDeletions()
+
+	doc := u.GetDoc()
+	if doc.keptStacks == nil {
+		doc.keptStacks = make(map[*UndoManager]struct{})
+	}
+	doc.keptStacks[u] = struct{}{}
+}
+
+// collectable reports whether the deleted item may be garbage collected, it mustn't be kept by the stacks of an undo
+// manager of the doc and must pass GCFilter.
+func (doc *Doc) collectable(item *Item) bool {
+	for u := range doc.keptStacks {
+		if u.kept != nil && IsDeleted(u.kept, &item.ID) && u.isParentOf(item) {
+			return false
+		}
+	}
+	return doc.GCFilter == nil || doc.GCFilter(item)
+}
+
+// stackDeletions merges the deletions of all stack items.
+func (u *UndoManager) stackDeletions() *DeleteSet {
+	var dss []*DeleteSet
+	for _, stack := range [][]*StackItem{u.UndoStack, u.RedoStack} {
+		for _, stackItem := range stack {
+			dss = append(dss, stackItem.Deletions)
+		}
+	}
+	return MergeDeleteSets(dss)
+}
@@ -0,0 +1,129 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUndoStacksEncoding(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	u := NewUndoManager(text, 0, func(item *Item) bool { return true }, NewSet())
+
+	var anchor, head Number
+	u.TrackSelection(text, func() (Number, Number) {
+		return anchor, head
+	}, func(a, h Number) {
+		anchor, head = a, h
+	})
+
+	text.Insert(0, "hello world", nil)
+	anchor, head = 6, 11
+	doc.Transact(func(trans *Transaction) {
+		text.Delete(6, 5)
+		text.Insert(6, "there", nil)
+	}, nil)
+	u.UndoStack[1].Meta["note"] = "an edit"
+
+	data, err := EncodeUndoStacks(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := EncodeStateAsUpdate(doc, nil)
+
+	// the stacks are decoded before the state, so that the deleted content isn't collected while loading
+	restored := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	restoredText := restored.GetText("text")
+	restoredUndo := NewUndoManager(restoredText, 0, func(item *Item) bool { return true }, NewSet())
+	anchor, head = 0, 0
+	restoredUndo.TrackSelection(restoredText, func() (Number, Number) {
+		return anchor, head
+	}, func(a, h Number) {
+		anchor, head = a, h
+	})
+
+	if err := DecodeUndoStacks(restoredUndo, data); err != nil {
+		t.Fatal(err)
+	}
+	ApplyUpdate(restored, update, "persistence")
+
+	if len(restoredUndo.UndoStack) != 2 || len(restoredUndo.RedoStack) != 0 {
+		t.Fatalf("expected 2 undo stack items, got %d %d", len(restoredUndo.UndoStack), len(restoredUndo.RedoStack))
+	}
+
+	if note := restoredUndo.UndoStack[1].Meta["note"]; note != "an edit" {
+		t.Errorf("expected meta to be decoded, got %v", note)
+	}
+
+	if _, ok := restoredUndo.UndoStack[1].Meta[MetaKeySelection].(*Cursor); !ok {
+		t.Errorf("expected selection to be decoded as cursor, got %T", restoredUndo.UndoStack[1].Meta[MetaKeySelection])
+	}
+
+	restoredUndo.Undo()
+	if s := restoredText.ToString(); s != "hello world" || anchor != 6 || head != 11 {
+		t.Errorf("expected deleted content and selection to be restored, got %q %d %d", s, anchor, head)
+	}
+
+	restoredUndo.Redo()
+	if s := restoredText.ToString(); s != "hello there" {
+		t.Errorf("expected redo of the restored stack, got %q", s)
+	}
+
+	restoredUndo.Undo()
+	restoredUndo.Undo()
+	if s := restoredText.ToString(); s != "" || restoredUndo.Undo() != nil {
+		t.Errorf("expected all changes to be undone, got %q", s)
+	}
+
+	if err := DecodeUndoStacks(restoredUndo, []byte{1, 1}); err != ErrInvalidData {
+		t.Errorf("expected invalid data, got %v", err)
+	}
+
+	// the GC filter of the doc isn't replaced, and destroyed managers don't keep their stacks
+	restoredUndo.Destroy()
+	if reflect.ValueOf(restored.GCFilter).Pointer() != reflect.ValueOf(DefaultGCFilter).Pointer() {
+		t.Errorf("expected GC filter of the doc to be kept")
+	}
+
+	if len(restored.keptStacks) != 0 {
+		t.Errorf("expected destroyed manager to be removed from the doc")
+	}
+
+	u.UndoStack[0].Meta[1] = "not a string key"
+	if _, err := EncodeUndoStacks(u); err == nil {
+		t.Errorf("expected error for a meta key that isn't a string")
+	}
+}
+
+func TestUndoStacksEncodingManagers(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	u := NewUndoManager(text, 0, func(item *Item) bool { return true }, NewSet())
+	text.Insert(0, "hello world", nil)
+	text.Delete(6, 5)
+
+	data, err := EncodeUndoStacks(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first manager is destroyed before the state is loaded, the second one still keeps its stacks
+	restored := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	restoredText := restored.GetText("text")
+	var managers []*UndoManager
+	for i := 0; i < 2; i++ {
+		m := NewUndoManager(restoredText, 0, func(item *Item) bool { return true }, NewSet())
+		if err := DecodeUndoStacks(m, data); err != nil {
+			t.Fatal(err)
+		}
+		managers = append(managers, m)
+	}
+
+	managers[0].Destroy()
+	ApplyUpdate(restored, EncodeStateAsUpdate(doc, nil), "persistence")
+
+	managers[1].Undo()
+	if s := restoredText.ToString(); s != "hello world" {
+		t.Errorf("expected deleted content to be kept for the remaining manager, got %q", s)
+	}
+}
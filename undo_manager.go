@@ -4,6 +4,23 @@ import (
 	"reflect"
 )
 
+const (
+	EventStackItemAdded   = "stack-item-added"
+	EventStackItemUpdated = "stack-item-updated"
+	EventStackItemPopped  = "stack-item-popped"
+
+	// MetaKeySelection is the key of the selection that TrackSelection stores in StackItem.Meta.
+	MetaKeySelection = "selection"
+)
+
+// StackItemEvent is passed to the observers of the stack item events of an UndoManager.
+type StackItemEvent struct {
+	StackItem          *StackItem
+	Type               string // "undo" or "redo", the stack of the stack item
+	ChangedParentTypes map[interface{}][]IEventType
+	Origin             interface{} // origin of the transaction
+}
+
 type StackItem struct {
 	Insertions *DeleteSet
 	Deletions  *DeleteSet
@@ -21,42 +38,253 @@ type StackItem struct {
 //	Fires 'stack-item-added' event when a stack item was added to either the undo- or
 //	the redo-stack. You may store additional stack information via the
 //	metadata property on `event.stackItem.meta` (it is a `Map` of metadata properties).
+//	Fires 'stack-item-updated' event when a change was merged into the last stack item.
 //	Fires 'stack-item-popped' event when a stack item was popped from either the
 //	undo- or the redo-stack. You may restore the saved stack information from `event.stackItem.meta`.
+//	The payload of all events is a *StackItemEvent.
 //
-//	@extends {Observable<'stack-item-added'|'stack-item-popped'>}
+//	@extends {Observable<'stack-item-added'|'stack-item-updated'|'stack-item-popped'>}
 type UndoManager struct {
 	*Observable
 	Scopes         []IAbstractType
 	DeleteFilter   func(item *Item) bool
 	TrackedOrigins Set
+	CaptureTimeout Number // ms
 	UndoStack      []*StackItem
 	RedoStack      []*StackItem
 
+	// MaxStackDepth and MaxMemory bound each stack, 0 is unbounded. The oldest stack items are dropped once a stack
+	// holds more than MaxStackDepth items, or once the deleted content kept for both stacks is estimated to need
+	// more than MaxMemory bytes.
+	MaxStackDepth int
+	MaxMemory     int64
+
 	// Whether the client is currently undoing (calling UndoManager.undo)
 	Undoing    bool
 	Redoing    bool
 	LastChange Number
+
+	afterTransaction *ObserverHandler
+	kept             *DeleteSet // deletions of the stacks that are kept from being garbage collected
+	ignoresNilOrigin bool       // changes without origin are not captured, see UndoRegistry
+}
+
+// IdentifiedOrigin is implemented by structured transaction origins. The UndoManager tracks them by their
+// identity if TrackedOrigins doesn't hold the origin itself, e.g. all changes of a user whatever their source.
+type IdentifiedOrigin interface {
+	Identity() interface{}
 }
 
 func (u *UndoManager) GetDoc() *Doc {
 	return u.Scopes[0].GetDoc()
 }
 
+// OnStackItem calls f for the event name, one of EventStackItemAdded, EventStackItemUpdated and
+// EventStackItemPopped. The returned handler removes f by Off.
+func (u *UndoManager) OnStackItem(name string, f func(event *StackItemEvent)) *ObserverHandler {
+	handler := NewObserverHandler(func(v ...interface{}) {
+		f(v[0].(*StackItemEvent))
+	})
+	u.On(name, handler)
+	return handler
+}
+
+// TrackSelection stores the selection of t before each captured change in StackItem.Meta, and restores it after
+// the stack item is undone or redone. selection returns the current selection as indexes of t, restore receives
+// the indexes of the restored selection. Call stop to end the tracking.
+func (u *UndoManager) TrackSelection(t IAbstractType, selection func() (anchor, head Number), restore func(anchor, head Number)) (stop func()) {
+	doc := u.GetDoc()
+	var before *Cursor
+	beforeTransaction := NewObserverHandler(func(v ...interface{}) {
+		anchor, head := selection()
+		before = NewCursor(t, anchor, head)
+	})
+	doc.On("beforeTransaction", beforeTransaction)
+
+	added := u.OnStackItem(EventStackItemAdded, func(event *StackItemEvent) {
+		if before != nil {
+			event.StackItem.Meta[MetaKeySelection] = before
+		}
+	})
+
+	popped := u.OnStackItem(EventStackItemPopped, func(event *StackItemEvent) {
+		cursor, ok := event.StackItem.Meta[MetaKeySelection].(*Cursor)
+		if !ok {
+			return
+		}
+
+		anchor, head := cursor.Resolve(doc)
+		if anchor != nil && head != nil {
+			restore(anchor.Index, head.Index)
+		}
+	})
+
+	return func() {
+		doc.Off("beforeTransaction", beforeTransaction)
+		u.Off(EventStackItemAdded, added)
+		u.Off(EventStackItemPopped, popped)
+	}
+}
+
+// AddToScope extends the scope of the UndoManager by ytypes, the changes of all scopes are captured together.
+// All types must belong to the doc of the UndoManager.
+func (u *UndoManager) AddToScope(ytypes ...IAbstractType) {
+	for _, ytype := range ytypes {
+		if u.inScope(ytype) {
+			continue
+		}
+
+		if len(u.Scopes) > 0 && ytype.GetDoc() != u.GetDoc() {
+			Logf("[crdt] UndoManager: all scopes must belong to the same doc.")
+			continue
+		}
+		u.Scopes = append(u.Scopes, ytype)
+	}
+}
+
+func (u *UndoManager) inScope(ytype IAbstractType) bool {
+	for _, scope := range u.Scopes {
+		if scope == ytype {
+			return true
+		}
+	}
+	return false
+}
+
+// isParentOf reports whether item belongs to one of the scopes.
+func (u *UndoManager) isParentOf(item *Item) bool {
+	for _, scope := range u.Scopes {
+		if IsParentOf(scope, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// tracks reports whether the changes of a transaction with origin are captured: origin is nil, or origin, its
+// identity or the name of its type is in TrackedOrigins.
+func (u *UndoManager) tracks(origin interface{}) bool {
+	if origin == nil {
+		return !u.ignoresNilOrigin
+	}
+
+	if u.TrackedOrigins.Has(origin) {
+		return true
+	}
+
+	if identified, ok := origin.(IdentifiedOrigin); ok && u.TrackedOrigins.Has(identified.Identity()) {
+		return true
+	}
+
+	return u.TrackedOrigins.Has(reflect.TypeOf(origin).String())
+}
+
+// limitStacks drops the oldest stack items that exceed MaxStackDepth or MaxMemory, the content they kept from
+// being garbage collected is collected.
+func (u *UndoManager) limitStacks(trans *Transaction) {
+	var dropped []*StackItem
+	for _, stack := range []*[]*StackItem{&u.UndoStack, &u.RedoStack} {
+		if u.MaxStackDepth > 0 && len(*stack) > u.MaxStackDepth {
+			n := len(*stack) - u.MaxStackDepth
+			dropped = append(dropped, (*stack)[:n]...)
+			*stack = append([]*StackItem(nil), (*stack)[n:]...)
+		}
+	}
+
+	if u.MaxMemory > 0 {
+		memory := u.stackMemory()
+		for memory > u.MaxMemory && len(u.UndoStack)+len(u.RedoStack) > 0 {
+			stack := &u.UndoStack
+			if len(u.UndoStack) == 0 {
+				stack = &u.RedoStack
+			}
+
+			stackItem := (*stack)[0]
+			*stack = (*stack)[1:]
+			memory -= estimateDeleteSetMemory(u.GetDoc().Store, stackItem.Deletions)
+			dropped = append(dropped, stackItem)
+		}
+	}
+
+	if u.kept != nil && len(dropped) > 0 {
+		u.kept = u.stackDeletions()
+	}
+
+	doc := u.GetDoc()
+	for _, stackItem := range dropped {
+		IterateDeletedStructs(trans, stackItem.Deletions, func(s IAbstractStruct) {
+			if item, ok := s.(*Item); ok && u.isParentOf(item) {
+				KeepItem(item, false)
+			}
+		})
+
+		if doc.GC {
+			TryGc(stackItem.Deletions, doc.Store, doc.collectable)
+		}
+	}
+}
+
+// stackMemory estimates the memory of the deleted content that the stacks keep from being garbage collected.
+func (u *UndoManager) stackMemory() int64 {
+	var memory int64
+	store := u.GetDoc().Store
+	for _, stack := range [][]*StackItem{u.UndoStack, u.RedoStack} {
+		for _, stackItem := range stack {
+			memory += estimateDeleteSetMemory(store, stackItem.Deletions)
+		}
+	}
+	return memory
+}
+
+// estimateDeleteSetMemory estimates the memory of the deleted items in ds that still hold content. Deleted items
+// are merged, an item that is partly in ds is counted by the share of its length in ds.
+func estimateDeleteSetMemory(store *StructStore, ds *DeleteSet) int64 {
+	var memory int64
+	for client, deletes := range ds.Clients {
+		structs, exist := store.Clients[client]
+		if !exist {
+			continue
+		}
+
+		for _, del := range deletes {
+			index, err := FindIndexSS(*structs, del.Clock)
+			if err != nil {
+				continue
+			}
+
+			end := del.Clock + del.Length
+			for ; index < len(*structs) && (*structs)[index].GetID().Clock < end; index++ {
+				item, ok := (*structs)[index].(*Item)
+				if !ok {
+					continue
+				}
+
+				if _, ok := item.Content.(*ContentDeleted); ok {
+					continue
+				}
+
+				overlap := Min(end, item.ID.Clock+item.Length) - Max(del.Clock, item.ID.Clock)
+				memory += (structMemory + estimateContentMemory(item.Content)) * int64(overlap) / int64(item.Length)
+			}
+		}
+	}
+	return memory
+}
+
+// Destroy stops to capture changes, the stacks are kept.
+func (u *UndoManager) Destroy() {
+	u.TrackedOrigins.Delete(u)
+	u.GetDoc().Off("afterTransaction", u.afterTransaction)
+	delete(u.GetDoc().keptStacks, u)
+	u.Observable.Destroy()
+}
+
 func (u *UndoManager) Clear() {
 	u.GetDoc().Transact(func(trans *Transaction) {
 		clearItem := func(stackItem *StackItem) {
 			IterateDeletedStructs(trans, stackItem.Deletions, func(s IAbstractStruct) {
 				item, ok := s.(*Item)
-				isParent := false
-				for _, scope := range u.Scopes {
-					if IsParentOf(scope, item) {
-						isParent = true
-						break
-					}
-				}
-
-				if ok && isParent {
+				if ok && u.isParentOf(item) {
 					KeepItem(item, false)
 				}
 			})
@@ -73,6 +301,7 @@ func (u *UndoManager) Clear() {
 
 	u.UndoStack = nil
 	u.RedoStack = nil
+	u.kept = nil
 }
 
 // UndoManager merges Undo-StackItem if they are created within time-gap
@@ -99,7 +328,7 @@ func (u *UndoManager) StopCapturing() {
 // Undo last changes on type.
 func (u *UndoManager) Undo() *StackItem {
 	u.Undoing = true
-	res := PopStackItem(u, u.UndoStack, "undo")
+	res := PopStackItem(u, &u.UndoStack, "undo")
 	u.Undoing = false
 	return res
 }
@@ -107,7 +336,7 @@ func (u *UndoManager) Undo() *StackItem {
 // Redo last undo operation.
 func (u *UndoManager) Redo() *StackItem {
 	u.Redoing = true
-	res := PopStackItem(u, u.RedoStack, "redo")
+	res := PopStackItem(u, &u.RedoStack, "redo")
 	u.Redoing = false
 	return res
 }
@@ -120,19 +349,20 @@ func NewStackItem(deletes *DeleteSet, insertions *DeleteSet) *StackItem {
 	}
 }
 
-func PopStackItem(undoManager *UndoManager, stack []*StackItem, eventType string) *StackItem {
+// PopStackItem reverts the last stack item of stack that still changes the doc, and removes it and the stack items
+// above it from stack.
+func PopStackItem(undoManager *UndoManager, stack *[]*StackItem, eventType string) *StackItem {
 	// Whether a change happened
 	var result *StackItem
 
 	// Keep a reference to the transaction so we can fire the event with the changedParentTypes
 	var tr *Transaction
 	doc := undoManager.GetDoc()
-	scopes := undoManager.Scopes
 	Transact(doc, func(trans *Transaction) {
-		for len(stack) > 0 && result == nil {
+		for len(*stack) > 0 && result == nil {
 			store := doc.Store
-			stackItem := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
+			stackItem := (*stack)[len(*stack)-1]
+			*stack = (*stack)[:len(*stack)-1]
 			itemsToRedo := NewSet()
 			var itemsToDelete []*Item
 			performedChange := false
@@ -148,15 +378,7 @@ func PopStackItem(undoManager *UndoManager, stack []*StackItem, eventType string
 						it = item
 					}
 
-					isParent := false
-					for _, scope := range scopes {
-						if IsParentOf(scope, it) {
-							isParent = true
-							break
-						}
-					}
-
-					if !it.Deleted() && isParent {
+					if !it.Deleted() && undoManager.isParentOf(it) {
 						itemsToDelete = append(itemsToDelete, it)
 					}
 				}
@@ -164,15 +386,7 @@ func PopStackItem(undoManager *UndoManager, stack []*StackItem, eventType string
 
 			IterateDeletedStructs(trans, stackItem.Deletions, func(s IAbstractStruct) {
 				it, ok := s.(*Item)
-				isParent := false
-				for _, scope := range scopes {
-					if IsParentOf(scope, it) {
-						isParent = true
-						break
-					}
-				}
-
-				if ok && isParent && !IsDeleted(stackItem.Insertions, s.GetID()) {
+				if ok && undoManager.isParentOf(it) && !IsDeleted(stackItem.Insertions, s.GetID()) {
 					// Never redo structs in stackItem.insertions because they were created and deleted in the same capture interval.
 					itemsToRedo.Add(it)
 				}
@@ -211,22 +425,33 @@ func PopStackItem(undoManager *UndoManager, stack []*StackItem, eventType string
 	}, undoManager, true)
 
 	if result != nil {
-		changedParentTypes := tr.ChangedParentTypes
-		obj := NewObject()
-		obj["stackItem"] = result
-		obj["type"] = eventType
-		obj["changedParentTypes"] = changedParentTypes
-		undoManager.Emit("stack-item-popped", obj, undoManager)
+		undoManager.Emit(EventStackItemPopped, &StackItemEvent{
+			StackItem:          result,
+			Type:               eventType,
+			ChangedParentTypes: tr.ChangedParentTypes,
+			Origin:             undoManager,
+		}, undoManager)
 	}
 
 	return result
 }
 
 func NewUndoManager(typeScope IAbstractType, captureTimeout Number, deleteFilter func(item *Item) bool, trackedOrigins Set) *UndoManager {
+	return NewUndoManagerWithScopes([]IAbstractType{typeScope}, captureTimeout, deleteFilter, trackedOrigins)
+}
+
+// NewUndoManagerWithScopes creates an UndoManager that captures the changes of all scopes together, e.g. of a
+// title and a body. A transaction is captured if it changes any of the scopes. An empty trackedOrigins tracks the
+// changes without origin, like Yjs does by default.
+func NewUndoManagerWithScopes(scopes []IAbstractType, captureTimeout Number, deleteFilter func(item *Item) bool, trackedOrigins Set) *UndoManager {
 	u := &UndoManager{}
 	u.Observable = NewObservable()
-	u.Scopes = append(u.Scopes, typeScope)
+	u.AddToScope(scopes...)
+	u.CaptureTimeout = captureTimeout
 	u.DeleteFilter = deleteFilter
+	if trackedOrigins == nil {
+		trackedOrigins = NewSet()
+	}
 	trackedOrigins.Add(u)
 	u.TrackedOrigins = trackedOrigins
 
@@ -235,23 +460,27 @@ func NewUndoManager(typeScope IAbstractType, captureTimeout Number, deleteFilter
 
 	doc := u.GetDoc()
 	u.LastChange = 0
-	doc.On("afterTransaction", NewObserverHandler(func(v ...interface{}) {
+	u.afterTransaction = NewObserverHandler(func(v ...interface{}) {
 		// Only track certain transactions
 		if len(v) == 0 {
 			return
 		}
 
 		trans := v[0].(*Transaction)
+		changed := false
 		for _, t := range u.Scopes {
-			if _, exist := trans.ChangedParentTypes[t]; !exist {
-				return
+			if _, exist := trans.ChangedParentTypes[t]; exist {
+				changed = true
+				break
 			}
 		}
 
-		if trans.Origin != nil {
-			if !u.TrackedOrigins.Has(trans.Origin) && (trans.Origin != nil || !u.TrackedOrigins.Has(reflect.TypeOf(trans.Origin).String())) {
-				return
-			}
+		if !changed {
+			return
+		}
+
+		if !u.tracks(trans.Origin) {
+			return
 		}
 		undoing := u.Undoing
 		redoing := u.Redoing
@@ -281,11 +510,13 @@ func NewUndoManager(typeScope IAbstractType, captureTimeout Number, deleteFilter
 		}
 
 		now := GetUnixTime() // ms
-		if Number(now)-u.LastChange < captureTimeout && len(*stack) > 0 && !undoing && !redoing {
+		eventName := EventStackItemAdded
+		if Number(now)-u.LastChange < u.CaptureTimeout && len(*stack) > 0 && !undoing && !redoing {
 			// append change to last stack op
 			lastOp := (*stack)[len(*stack)-1]
 			lastOp.Deletions = MergeDeleteSets([]*DeleteSet{lastOp.Deletions, trans.DeleteSet})
 			lastOp.Insertions = MergeDeleteSets([]*DeleteSet{lastOp.Insertions, insertions})
+			eventName = EventStackItemUpdated
 		} else {
 			// create a new stack op
 			*stack = append(*stack, NewStackItem(trans.DeleteSet, insertions))
@@ -297,33 +528,24 @@ func NewUndoManager(typeScope IAbstractType, captureTimeout Number, deleteFilter
 
 		// make sure that deleted structs are not gc'd
 		IterateDeletedStructs(trans, trans.DeleteSet, func(item IAbstractStruct) {
-			keep := false
-			if IsSameType(item, &Item{}) {
-				it := item.(*Item)
-				for _, t := range u.Scopes {
-					if IsParentOf(t, it) {
-						keep = true
-						break
-					}
-				}
-			}
-
-			if keep {
-				KeepItem(item.(*Item), true)
+			if it, ok := item.(*Item); ok && u.isParentOf(it) {
+				KeepItem(it, true)
 			}
 		})
 
-		obj := NewObject()
-		obj["stackItem"] = (*stack)[len(*stack)-1]
-		obj["origin"] = trans.Origin
+		event := &StackItemEvent{
+			StackItem:          (*stack)[len(*stack)-1],
+			Type:               "undo",
+			ChangedParentTypes: trans.ChangedParentTypes,
+			Origin:             trans.Origin,
+		}
 		if undoing {
-			obj["type"] = "redo"
-		} else {
-			obj["type"] = "undo"
+			event.Type = "redo"
 		}
-		obj["changedParentTypes"] = trans.ChangedParentTypes
-		u.Emit("stack-item-added", obj, u)
-	}))
+		u.Emit(eventName, event, u)
+		u.limitStacks(trans)
+	})
+	doc.On("afterTransaction", u.afterTransaction)
 
 	return u
 }
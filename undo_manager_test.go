@@ -0,0 +1,199 @@
+package y_crdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func xmlString(fragment IAbstractType) string {
+	return fragment.(*YXmlFragment).ToString()
+}
+
+func TestUndoManagerScopes(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	title := doc.GetText("title")
+	body := doc.GetXmlFragment("body").(*YXmlFragment)
+	u := NewUndoManagerWithScopes([]IAbstractType{title, body}, 0, func(item *Item) bool { return true }, NewSet())
+
+	title.Insert(0, "Title", nil)
+	paragraph := NewYXmlElement("p")
+	body.Insert(0, ArrayAny{paragraph})
+	paragraph.Insert(0, ArrayAny{NewYXmlText()})
+
+	// a transaction that changes several scopes is one stack item
+	doc.Transact(func(trans *Transaction) {
+		title.Insert(5, "!", nil)
+		paragraph.Get(0).(*YXmlText).Insert(0, "body", nil)
+	}, nil)
+
+	if len(u.UndoStack) != 4 {
+		t.Fatalf("expected 4 stack items, got %d", len(u.UndoStack))
+	}
+
+	u.Undo()
+	if title.ToString() != "Title" || paragraph.Get(0).(*YXmlText).ToString() != "" {
+		t.Errorf("expected changes of both scopes to be undone, got %s %s", title.ToString(), xmlString(body))
+	}
+
+	if len(u.UndoStack) != 3 || len(u.RedoStack) != 1 {
+		t.Errorf("expected stack item to be moved to the redo stack, got %d %d", len(u.UndoStack), len(u.RedoStack))
+	}
+
+	u.Undo()
+	u.Undo()
+	if body.GetLength() != 0 || title.ToString() != "Title" {
+		t.Errorf("expected paragraph to be removed, got %s %s", title.ToString(), xmlString(body))
+	}
+
+	u.Redo()
+	u.Redo()
+	u.Redo()
+	if title.ToString() != "Title!" || xmlString(body) != "<p>body</p>" {
+		t.Errorf("expected changes to be redone, got %s %s", title.ToString(), xmlString(body))
+	}
+
+	// changes outside of the scopes are not captured
+	doc.GetText("other").Insert(0, "other", nil)
+	if len(u.UndoStack) != 4 {
+		t.Errorf("expected change outside of the scopes to be ignored, got %d stack items", len(u.UndoStack))
+	}
+
+	// scopes can be added later
+	u.AddToScope(doc.GetText("other"), title)
+	if len(u.Scopes) != 3 {
+		t.Errorf("expected 3 scopes, got %d", len(u.Scopes))
+	}
+
+	doc.GetText("other").Insert(0, "more ", nil)
+	u.Undo()
+	if doc.GetText("other").ToString() != "other" {
+		t.Errorf("expected change of the added scope to be undone, got %s", doc.GetText("other").ToString())
+	}
+
+	// an empty stack is a no-op
+	for u.Undo() != nil {
+	}
+	if u.Undo() != nil || title.ToString() != "" || body.GetLength() != 0 {
+		t.Errorf("expected all changes to be undone, got %s %s", title.ToString(), xmlString(body))
+	}
+}
+
+func TestUndoManagerCaptureTimeout(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	u := NewUndoManager(text, 60000, func(item *Item) bool { return true }, NewSet())
+
+	text.Insert(0, "a", nil)
+	text.Insert(1, "b", nil)
+	u.StopCapturing()
+	text.Insert(2, "c", nil)
+
+	u.Undo()
+	if text.ToString() != "ab" {
+		t.Errorf("expected only the change after StopCapturing to be undone, got %s", text.ToString())
+	}
+
+	u.Undo()
+	if text.ToString() != "" {
+		t.Errorf("expected merged changes to be undone together, got %s", text.ToString())
+	}
+}
+
+func TestUndoManagerEvents(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	u := NewUndoManager(text, 60000, func(item *Item) bool { return true }, NewSet())
+
+	var events []string
+	for _, name := range []string{EventStackItemAdded, EventStackItemUpdated, EventStackItemPopped} {
+		name := name
+		u.OnStackItem(name, func(event *StackItemEvent) {
+			if _, exist := event.ChangedParentTypes[text]; !exist {
+				t.Errorf("expected %s event to report the changed text", name)
+			}
+			events = append(events, name+" "+event.Type)
+		})
+	}
+
+	text.Insert(0, "hello", nil)
+	text.Insert(5, " world", nil)
+	u.Undo()
+	u.Redo()
+
+	expected := []string{
+		"stack-item-added undo",
+		"stack-item-updated undo",
+		"stack-item-added redo", // the undo is captured by the redo stack
+		"stack-item-popped undo",
+		"stack-item-added undo",
+		"stack-item-popped redo",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %v, got %v", expected, events)
+	}
+}
+
+func TestUndoManagerTrackSelection(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	text.Insert(0, "hello world", nil)
+	u := NewUndoManager(text, 0, func(item *Item) bool { return true }, NewSet())
+
+	var anchor, head Number = 6, 11
+	stop := u.TrackSelection(text, func() (Number, Number) {
+		return anchor, head
+	}, func(a, h Number) {
+		anchor, head = a, h
+	})
+
+	// replace the selected "world"
+	doc.Transact(func(trans *Transaction) {
+		text.Delete(6, 5)
+		text.Insert(6, "there", nil)
+	}, nil)
+	anchor, head = 11, 11
+
+	// a remote change moves the stored selection
+	remote := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	ApplyUpdate(remote, EncodeStateAsUpdate(doc, nil), nil)
+	remote.GetText("text").Insert(0, "oh, ", nil)
+	ApplyUpdate(doc, EncodeStateAsUpdate(remote, EncodeStateVector(doc, nil, NewUpdateEncoderV1())), "remote")
+
+	u.Undo()
+	if text.ToString() != "oh, hello world" || anchor != 10 || head != 15 {
+		t.Errorf("expected selection of world to be restored, got %s %d %d", text.ToString(), anchor, head)
+	}
+
+	stop()
+	anchor, head = 0, 0
+	u.Redo()
+	if anchor != 0 || head != 0 {
+		t.Errorf("expected selection not to be restored after stop")
+	}
+}
+
+type testOrigin struct{}
+
+func TestUndoManagerTrackedOrigins(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	trackedOrigins := NewSet()
+	trackedOrigins.Add("tracked")
+	trackedOrigins.Add(reflect.TypeOf(testOrigin{}).String())
+	undoManager := NewUndoManager(text, 0, func(item *Item) bool { return true }, trackedOrigins)
+
+	// changes without origin are always captured
+	text.Insert(0, "a", nil)
+	doc.Transact(func(trans *Transaction) { text.Insert(1, "b", nil) }, "tracked")
+	doc.Transact(func(trans *Transaction) { text.Insert(2, "c", nil) }, testOrigin{})
+	doc.Transact(func(trans *Transaction) { text.Insert(3, "d", nil) }, "other")
+	if n := len(undoManager.UndoStack); n != 3 {
+		t.Fatalf("expected 3 captured changes, got %d", n)
+	}
+
+	for undoManager.Undo() != nil {
+	}
+	if s := text.ToString(); s != "d" {
+		t.Errorf("expected only the untracked change to stay, got %q", s)
+	}
+}
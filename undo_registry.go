@@ -0,0 +1,169 @@
+package y_crdt
+
+import (
+	"sort"
+	"sync"
+)
+
+// UserOrigin is the transaction origin of a change that a server applies on behalf of a user, e.g. by a bot or a
+// REST call. UndoManagers track it by User, whatever the Source.
+type UserOrigin struct {
+	User   string
+	Source string // informational, e.g. "rest" or "bot"
+}
+
+// Identity implements IdentifiedOrigin.
+func (o UserOrigin) Identity() interface{} {
+	return UserOrigin{User: o.User}
+}
+
+// UndoRegistry keeps an UndoManager per user and doc, so that undo reverts only the changes of one user while
+// many users change the same doc. The changes of a user must be applied with a UserOrigin of the user, e.g. by
+// Transact, changes of other origins are never undone.
+//
+// The docs must be locked while they are changed or undone, the registry itself is safe for concurrent use.
+type UndoRegistry struct {
+	// Scopes returns the types of a doc that are undone. It is called for every UndoManager, so each user gets
+	// the scopes of the time their UndoManager is created. If nil, the root types of the doc at that time are
+	// used.
+	Scopes         func(doc *Doc) []IAbstractType
+	CaptureTimeout Number // ms
+	MaxStackDepth  int    // per stack, 0 is unbounded
+	MaxMemory      int64  // bytes per UndoManager, 0 is unbounded
+
+	mutex    sync.Mutex
+	managers map[*Doc]map[string]*UndoManager
+	handlers map[*Doc]*ObserverHandler
+}
+
+func NewUndoRegistry(scopes func(doc *Doc) []IAbstractType, maxStackDepth int, maxMemory int64) *UndoRegistry {
+	return &UndoRegistry{
+		Scopes:        scopes,
+		MaxStackDepth: maxStackDepth,
+		MaxMemory:     maxMemory,
+		managers:      make(map[*Doc]map[string]*UndoManager),
+		handlers:      make(map[*Doc]*ObserverHandler),
+	}
+}
+
+// Get returns the UndoManager of user in doc, it is created if it doesn't exist. Only the changes after the
+// UndoManager was created are captured. Get returns nil if doc has no scopes.
+func (r *UndoRegistry) Get(doc *Doc, user string) *UndoManager {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	managers, exist := r.managers[doc]
+	if !exist {
+		managers = make(map[string]*UndoManager)
+		r.managers[doc] = managers
+
+		handler := NewObserverHandler(func(v ...interface{}) {
+			r.RemoveDoc(doc)
+		})
+		doc.On("destroy", handler)
+		r.handlers[doc] = handler
+	}
+
+	u, exist := managers[user]
+	if !exist {
+		scopes := r.scopes(doc)
+		if len(scopes) == 0 {
+			Logf("[crdt] UndoRegistry: doc %s has no scopes.", doc.Guid)
+			return nil
+		}
+
+		trackedOrigins := NewSet()
+		trackedOrigins.Add(UserOrigin{User: user})
+		u = NewUndoManagerWithScopes(scopes, r.CaptureTimeout, func(item *Item) bool { return true }, trackedOrigins)
+		u.ignoresNilOrigin = true
+		u.MaxStackDepth = r.MaxStackDepth
+		u.MaxMemory = r.MaxMemory
+		managers[user] = u
+	}
+
+	return u
+}
+
+// Transact changes doc on behalf of user.
+func (r *UndoRegistry) Transact(doc *Doc, user string, f func(trans *Transaction)) {
+	r.Get(doc, user)
+	doc.Transact(f, UserOrigin{User: user})
+}
+
+// Undo reverts the last change of user in doc, nil if there is nothing to undo.
+func (r *UndoRegistry) Undo(doc *Doc, user string) *StackItem {
+	if u := r.Get(doc, user); u != nil {
+		return u.Undo()
+	}
+	return nil
+}
+
+// Redo reapplies the last change of user in doc that was undone, nil if there is nothing to redo.
+func (r *UndoRegistry) Redo(doc *Doc, user string) *StackItem {
+	if u := r.Get(doc, user); u != nil {
+		return u.Redo()
+	}
+	return nil
+}
+
+// Users returns the users of doc that have an UndoManager.
+func (r *UndoRegistry) Users(doc *Doc) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	users := make([]string, 0, len(r.managers[doc]))
+	for user := range r.managers[doc] {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Remove destroys the UndoManager of user in doc.
+func (r *UndoRegistry) Remove(doc *Doc, user string) {
+	r.mutex.Lock()
+	u, exist := r.managers[doc][user]
+	delete(r.managers[doc], user)
+	r.mutex.Unlock()
+
+	if exist {
+		u.Clear()
+		u.Destroy()
+	}
+}
+
+// RemoveDoc destroys the UndoManagers of doc, it is called when doc is destroyed.
+func (r *UndoRegistry) RemoveDoc(doc *Doc) {
+	r.mutex.Lock()
+	managers := r.managers[doc]
+	handler, exist := r.handlers[doc]
+	delete(r.managers, doc)
+	delete(r.handlers, doc)
+	r.mutex.Unlock()
+
+	if exist {
+		doc.Off("destroy", handler)
+	}
+
+	for _, u := range managers {
+		u.Destroy()
+	}
+}
+
+func (r *UndoRegistry) scopes(doc *Doc) []IAbstractType {
+	if r.Scopes != nil {
+		return r.Scopes(doc)
+	}
+
+	names := make([]string, 0, len(doc.Share))
+	for name := range doc.Share {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scopes := make([]IAbstractType, 0, len(names))
+	for _, name := range names {
+		scopes = append(scopes, doc.Share[name])
+	}
+	return scopes
+}
@@ -0,0 +1,123 @@
+package y_crdt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUndoRegistry(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	items := doc.GetArray("items")
+	registry := NewUndoRegistry(nil, 0, 0)
+
+	// users A and B interleave their edits
+	registry.Transact(doc, "a", func(trans *Transaction) {
+		text.Insert(0, "A1 ", nil)
+	})
+	doc.Transact(func(trans *Transaction) {
+		text.Insert(text.GetLength(), "B1 ", nil)
+	}, UserOrigin{User: "b", Source: "rest"})
+	registry.Get(doc, "b")
+	doc.Transact(func(trans *Transaction) {
+		text.Insert(text.GetLength(), "B2 ", nil)
+		items.Insert(0, ArrayAny{"b"})
+	}, UserOrigin{User: "b", Source: "bot"})
+	registry.Transact(doc, "a", func(trans *Transaction) {
+		text.Insert(text.GetLength(), "A2", nil)
+		items.Insert(0, ArrayAny{"a"})
+	})
+
+	// changes without a user are never undone
+	text.Insert(0, "> ", nil)
+
+	if users := registry.Users(doc); len(users) != 2 || users[0] != "a" || users[1] != "b" {
+		t.Fatalf("expected undo managers of a and b, got %v", users)
+	}
+
+	registry.Undo(doc, "a")
+	if s := text.ToString(); s != "> A1 B1 B2 " || items.GetLength() != 1 || items.Get(0) != "b" {
+		t.Errorf("expected only the last change of a to be undone, got %q %v", s, items.ToArray())
+	}
+
+	registry.Undo(doc, "a")
+	if s := text.ToString(); s != "> B1 B2 " {
+		t.Errorf("expected all changes of a to be undone, got %q", s)
+	}
+
+	if registry.Undo(doc, "a") != nil {
+		t.Errorf("expected nothing to undo for a")
+	}
+
+	// B1 was applied before the undo manager of b was created
+	registry.Undo(doc, "b")
+	if s := text.ToString(); s != "> B1 " || items.GetLength() != 0 {
+		t.Errorf("expected change of b to be undone, got %q %v", s, items.ToArray())
+	}
+
+	registry.Redo(doc, "a")
+	if s := text.ToString(); s != "> A1 B1 " {
+		t.Errorf("expected change of a to be redone, got %q", s)
+	}
+
+	registry.Remove(doc, "a")
+	if users := registry.Users(doc); len(users) != 1 {
+		t.Errorf("expected undo manager of a to be removed, got %v", users)
+	}
+
+	doc.Destroy()
+	if users := registry.Users(doc); len(users) != 0 {
+		t.Errorf("expected undo managers of a destroyed doc to be removed, got %v", users)
+	}
+}
+
+func TestUndoRegistryLimits(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	registry := NewUndoRegistry(nil, 3, 0)
+
+	for i := 0; i < 5; i++ {
+		registry.Transact(doc, "a", func(trans *Transaction) {
+			text.Insert(text.GetLength(), "x", nil)
+		})
+	}
+
+	if n := len(registry.Get(doc, "a").UndoStack); n != 3 {
+		t.Errorf("expected stack depth of 3, got %d", n)
+	}
+
+	for registry.Undo(doc, "a") != nil {
+	}
+	if s := text.ToString(); s != "xx" {
+		t.Errorf("expected only 3 changes to be undone, got %q", s)
+	}
+
+	// the oldest stack items are dropped once the deleted content they keep exceeds the memory limit
+	registry.MaxStackDepth = 0
+	registry.MaxMemory = 1000
+	registry.Transact(doc, "b", func(trans *Transaction) {
+		text.Insert(0, strings.Repeat("y", 1000), nil)
+	})
+
+	u := registry.Get(doc, "b")
+	for i := 0; i < 3; i++ {
+		u.StopCapturing()
+		registry.Transact(doc, "b", func(trans *Transaction) {
+			text.Delete(0, 300)
+		})
+	}
+
+	if n := len(u.UndoStack); n != 2 {
+		t.Errorf("expected oldest stack items to be dropped, got %d stack items", n)
+	}
+
+	if memory := u.stackMemory(); memory > u.MaxMemory {
+		t.Errorf("expected memory of at most %d, got %d", u.MaxMemory, memory)
+	}
+
+	for registry.Undo(doc, "b") != nil {
+	}
+	if s := text.ToString(); s != strings.Repeat("y", 700)+"xx" {
+		t.Errorf("expected the last two deletions to be undone, got %d characters", text.GetLength())
+	}
+}
@@ -813,3 +813,321 @@ func CreateLazyStructReaderGenerator(decoder *UpdateDecoderV1, stopIfError bool)
 	generator := LazyStructReaderGenerator{decoder: decoder, stopIfError: stopIfError}
 	return generator
 }
+
+// ConvertUpdateFormatV1ToV2 converts a v1 update to the layout written by UpdateEncoderV2. UpdateEncoderV2 doesn't
+// implement the column encoding of Yjs yet, Yjs can't read the result, which is only meant for this package.
+func ConvertUpdateFormatV1ToV2(update []uint8) ([]uint8, error) {
+	structs, ds, err := splitUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := NewUpdateEncoderV2()
+	WriteUint8Array(encoder.RestEncoder, structs)
+	WriteDeleteSetV2(encoder, ds)
+	return encoder.ToUint8Array(), nil
+}
+
+// ConvertUpdateFormatV2ToV1 converts an update written by UpdateEncoderV2 to a v1 update.
+// V2 updates of Yjs, whose column encoders are not empty, are rejected.
+func ConvertUpdateFormatV2ToV1(update []uint8) ([]uint8, error) {
+	decoder := NewDecoder(update)
+	if ReadVarUint(decoder) != 0 {
+		return nil, errors.New("unsupported v2 update: unexpected feature flag")
+	}
+
+	// keyClock, client, leftClock, rightClock, info, string, parentInfo, typeRef, len
+	for i := 0; i < 9; i++ {
+		data, err := ReadVarUint8Array(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		column := data.([]uint8)
+		if len(column) > 0 && !(i == 5 && bytes.Equal(column, []uint8{0})) {
+			return nil, errors.New("unsupported v2 update: column encoders are not empty")
+		}
+	}
+
+	structs, rest, err := splitStructs(decoder.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := readDeleteSetV2(NewDecoder(rest))
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := NewUpdateEncoderV1()
+	WriteUint8Array(encoder.RestEncoder, structs)
+	WriteDeleteSet(encoder, ds)
+	return encoder.ToUint8Array(), nil
+}
+
+// splitUpdate splits a v1 update into the encoded structs and the delete set.
+func splitUpdate(update []uint8) ([]uint8, *DeleteSet, error) {
+	structs, rest, err := splitStructs(update)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ds := ReadDeleteSet(NewUpdateDecoderV1(rest))
+	if ds == nil {
+		return nil, nil, errors.New("read delete set failed")
+	}
+
+	return structs, ds, nil
+}
+
+// splitStructs returns the encoded structs of an update and the bytes that follow them.
+func splitStructs(update []uint8) (structs []uint8, rest []uint8, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrInvalidData
+		}
+	}()
+
+	decoder := NewUpdateDecoderV1(update)
+	reader := NewLazyStructReader(decoder, false, true)
+	for reader.Curr != nil {
+		reader.Next()
+	}
+
+	rest = decoder.RestDecoder.Bytes()
+	return update[:len(update)-len(rest)], rest, nil
+}
+
+func readDeleteSetV2(decoder *bytes.Buffer) (*DeleteSet, error) {
+	ds := NewDeleteSet()
+	numClients, err := readVarUint(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint64(0); i < numClients.(uint64); i++ {
+		client, err := readVarUint(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		numberOfDeletes, err := readVarUint(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		dsCurrVal := 0
+		for j := uint64(0); j < numberOfDeletes.(uint64); j++ {
+			diff, err := readVarUint(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			length, err := readVarUint(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			clock := dsCurrVal + Number(diff.(uint64))
+			dsCurrVal = clock + Number(length.(uint64)) + 1
+			AddToDeleteSet(ds, Number(client.(uint64)), clock, Number(length.(uint64))+1)
+		}
+	}
+
+	return ds, nil
+}
+
+// ConvertUpdateFormat rewrites every struct of an update with blockTransformer and
+// keeps the delete set untouched.
+func ConvertUpdateFormat(update []uint8, blockTransformer func(s IAbstractStruct) IAbstractStruct, YDecoder func([]byte) *UpdateDecoderV1, YEncoder func() *UpdateEncoderV1) (converted []uint8, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			converted = nil
+			err = ErrInvalidData
+		}
+	}()
+
+	updateDecoder := YDecoder(update)
+	lazyDecoder := NewLazyStructReader(updateDecoder, false, true)
+	updateEncoder := YEncoder()
+	lazyWriter := NewLazyStructWriter(updateEncoder)
+	for curr := lazyDecoder.Curr; curr != nil; curr = lazyDecoder.Next() {
+		WriteStructToLazyStructWriter(lazyWriter, blockTransformer(curr), 0)
+	}
+	FinishLazyStructWriting(lazyWriter)
+
+	ds := ReadDeleteSet(updateDecoder)
+	if ds == nil {
+		return nil, errors.New("read delete set failed")
+	}
+
+	WriteDeleteSet(updateEncoder, ds)
+	return updateEncoder.ToUint8Array(), nil
+}
+
+const (
+	updateHeaderSize    = 6  // # clients written, empty delete set
+	clientHeaderSize    = 20 // # structs, client, clock of a client section
+	deleteItemSize      = 20 // clock, length of a delete item
+	deleteSetHeaderSize = 16 // # structs, # clients
+)
+
+// SplitUpdate splits an update into several self-contained updates that are at most maxUpdateSize bytes,
+// applying all of them in order has the same effect as applying the update.
+//
+// Unlike DiffUpdates, maxUpdateSize is a hard limit: structs with large string, array or deleted content
+// are sliced, and the delete set is sent in separate updates after the structs.
+// Only a single struct that can't be sliced (e.g. a large binary) may exceed the limit, it is sent alone.
+func SplitUpdate(update []uint8, maxUpdateSize int) (updates [][]uint8, err error) {
+	if len(update) <= maxUpdateSize {
+		return [][]uint8{update}, nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			updates = nil
+			err = ErrInvalidData
+		}
+	}()
+
+	decoder := NewUpdateDecoderV1(update)
+	reader := NewLazyStructReader(decoder, false, true)
+
+	var writer *LazyStructWriter
+	size := 0
+	written := NewSet() // clients written to the current update
+
+	flush := func() {
+		if writer == nil {
+			return
+		}
+
+		FinishLazyStructWriting(writer)
+		WriteVarUint(writer.Encoder.RestEncoder, 0) // empty delete set
+		updates = append(updates, writer.Encoder.ToUint8Array())
+		writer = nil
+		written = NewSet()
+	}
+
+	write := func(s IAbstractStruct) {
+		newSection := writer == nil || writer.Written == 0 || writer.CurrClient != s.GetID().Client
+		if newSection && IsSameType(s, &Skip{}) {
+			// the first written struct shouldn't be a skip
+			return
+		}
+
+		cost := encodedStructSize(s)
+		if newSection {
+			cost += clientHeaderSize
+		}
+
+		// a client section can only be written once per update
+		if writer != nil && (size+cost > maxUpdateSize || (newSection && written.Has(s.GetID().Client))) {
+			flush()
+			if IsSameType(s, &Skip{}) {
+				return
+			}
+			cost = encodedStructSize(s) + clientHeaderSize
+		}
+
+		if writer == nil {
+			writer = NewLazyStructWriter(NewUpdateEncoderV1())
+			size = updateHeaderSize
+		}
+
+		WriteStructToLazyStructWriter(writer, s, 0)
+		written.Add(s.GetID().Client)
+		size += cost
+	}
+
+	for s := reader.Curr; s != nil; s = reader.Next() {
+		for _, part := range splitStruct(s, maxUpdateSize-updateHeaderSize-clientHeaderSize) {
+			write(part)
+		}
+	}
+	flush()
+
+	ds := ReadDeleteSet(decoder)
+	if ds == nil {
+		return nil, errors.New("read delete set failed")
+	}
+
+	updates = append(updates, splitDeleteSet(ds, maxUpdateSize)...)
+	return updates, nil
+}
+
+// splitStruct slices s into parts whose encoded size is at most maxSize.
+func splitStruct(s IAbstractStruct, maxSize int) []IAbstractStruct {
+	item, ok := s.(*Item)
+	if !ok || item.Length <= 1 || encodedStructSize(s) <= maxSize {
+		return []IAbstractStruct{s}
+	}
+
+	switch item.Content.(type) {
+	case *ContentString, *ContentAny, *ContentJson, *ContentDeleted:
+	default:
+		return []IAbstractStruct{s}
+	}
+
+	diff := item.Length / 2
+	if str, ok := item.Content.(*ContentString); ok {
+		// never split surrogate pairs, otherwise the content is replaced by an replacement character.
+		code, err := CharCodeAt(str.Str, diff-1)
+		if err == nil && code >= 0xD800 && code <= 0xDBFF {
+			diff++
+		}
+
+		if diff >= item.Length {
+			return []IAbstractStruct{s}
+		}
+	}
+
+	right := SliceStruct(item, diff)
+	item.SetLength(diff)
+	return append(splitStruct(item, maxSize), splitStruct(right, maxSize)...)
+}
+
+func encodedStructSize(s IAbstractStruct) int {
+	encoder := NewUpdateEncoderV1()
+	s.Write(encoder, 0)
+	return encoder.RestEncoder.Len()
+}
+
+// splitDeleteSet encodes ds as updates without structs that are at most maxUpdateSize bytes.
+func splitDeleteSet(ds *DeleteSet, maxUpdateSize int) [][]uint8 {
+	var updates [][]uint8
+	part := NewDeleteSet()
+	size := deleteSetHeaderSize
+
+	flush := func() {
+		encoder := NewUpdateEncoderV1()
+		WriteVarUint(encoder.RestEncoder, 0) // no structs
+		WriteDeleteSet(encoder, part)
+		updates = append(updates, encoder.ToUint8Array())
+		part = NewDeleteSet()
+		size = deleteSetHeaderSize
+	}
+
+	MapSortedRange(deleteSetSizes(ds), true, func(client, _ Number) {
+		for _, item := range ds.Clients[client] {
+			cost := deleteItemSize
+			if _, exist := part.Clients[client]; !exist {
+				cost += clientHeaderSize
+			}
+
+			if len(part.Clients) > 0 && size+cost > maxUpdateSize {
+				flush()
+				cost = deleteItemSize + clientHeaderSize
+			}
+
+			AddToDeleteSet(part, client, item.Clock, item.Length)
+			size += cost
+		}
+	})
+
+	if len(part.Clients) > 0 || len(updates) == 0 {
+		flush()
+	}
+
+	return updates
+}
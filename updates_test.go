@@ -0,0 +1,93 @@
+package y_crdt
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertUpdateFormat(t *testing.T) {
+	doc := NewDoc("guid", false, nil, nil, false)
+	ytext := doc.GetText("text")
+	ytext.Insert(0, "hello world", nil)
+	ytext.Delete(0, 2)
+	ytext.Delete(3, 4)
+
+	update := EncodeStateAsUpdate(doc, nil)
+	v2, err := ConvertUpdateFormatV1ToV2(update)
+	if err != nil {
+		t.Fatalf("convert v1 to v2 failed. err:%s", err.Error())
+	}
+
+	v1, err := ConvertUpdateFormatV2ToV1(v2)
+	if err != nil {
+		t.Fatalf("convert v2 to v1 failed. err:%s", err.Error())
+	}
+
+	if !bytes.Equal(update, v1) {
+		t.Errorf("expected %v, got %v", update, v1)
+	}
+
+	remote := NewDoc("guid", false, nil, nil, false)
+	ApplyUpdate(remote, v1, nil)
+	if remote.GetText("text").ToString() != ytext.ToString() {
+		t.Errorf("expected %s, got %s", ytext.ToString(), remote.GetText("text").ToString())
+	}
+
+	if _, err := ConvertUpdateFormatV2ToV1([]uint8{0, 1, 1}); err == nil {
+		t.Errorf("expected error on v2 update with column encoders")
+	}
+}
+
+func TestSplitUpdate(t *testing.T) {
+	doc := NewDoc("guid", false, nil, nil, false)
+	doc.ClientID = 1
+	ytext := doc.GetText("text")
+	ytext.Insert(0, strings.Repeat("hello 😀 world ", 100), nil)
+	ytext.Delete(10, 300)
+
+	remote := NewDoc("guid", false, nil, nil, false)
+	remote.ClientID = 2
+	ApplyUpdate(remote, EncodeStateAsUpdate(doc, nil), nil)
+	yarray := remote.GetArray("array")
+	yarray.Insert(0, ArrayAny{strings.Repeat("a", 500), 1, 2, 3})
+	remote.GetText("text").Insert(5, "remote", nil)
+	ApplyUpdate(doc, EncodeStateAsUpdate(remote, EncodeStateVector(doc, nil, NewUpdateEncoderV1())), nil)
+
+	update := EncodeStateAsUpdate(doc, nil)
+	updates, err := SplitUpdate(update, 200)
+	if err != nil {
+		t.Fatalf("split update failed. err:%s", err.Error())
+	}
+
+	if len(updates) < 2 {
+		t.Fatalf("expected update to be split, got %d updates", len(updates))
+	}
+
+	peer := NewDoc("guid", false, nil, nil, false)
+	for _, u := range updates {
+		// the string of 500 characters in an array can't be sliced
+		if len(u) > 200 && len(u) < 500 {
+			t.Errorf("expected updates of at most 200 bytes, got %d", len(u))
+		}
+		ApplyUpdate(peer, u, nil)
+	}
+
+	if peer.GetText("text").ToString() != ytext.ToString() {
+		t.Errorf("expected %s, got %s", ytext.ToString(), peer.GetText("text").ToString())
+	}
+
+	if !reflect.DeepEqual(peer.GetArray("array").ToJson(), doc.GetArray("array").ToJson()) {
+		t.Errorf("expected %v, got %v", doc.GetArray("array").ToJson(), peer.GetArray("array").ToJson())
+	}
+
+	if !reflect.DeepEqual(GetStateVector(peer.Store), GetStateVector(doc.Store)) {
+		t.Errorf("expected equal state vectors")
+	}
+
+	small, _ := SplitUpdate(update, len(update))
+	if len(small) != 1 || !bytes.Equal(small[0], update) {
+		t.Errorf("expected update that fits to be returned as is")
+	}
+}
@@ -0,0 +1,272 @@
+package y_crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultVersionsName is the name of the root type in which NewVersionHistory stores the versions by default.
+const DefaultVersionsName = "__versions"
+
+// ErrGCEnabled is returned for a version history or a diff of snapshots of a doc with GC. A snapshot can only be
+// restored or diffed if the deleted content is kept, migrate the doc by MigrateToNoGC.
+var ErrGCEnabled = errors.New("snapshots require a doc without GC, migrate the doc by MigrateToNoGC")
+
+// Version is a named snapshot of a doc.
+type Version struct {
+	Label     string
+	Author    string
+	Timestamp int64 // Unix time in milliseconds
+	Snapshot  *Snapshot
+}
+
+// VersionStore stores the versions of a VersionHistory.
+type VersionStore interface {
+	// Add appends a version.
+	Add(version *Version) error
+
+	// Versions returns the versions in the order they were added.
+	Versions() ([]*Version, error)
+}
+
+// VersionHistory captures versions of a doc, manually by Capture or on an interval by Start, and restores them as
+// new docs. The doc must not use GC, all content that a version references must be kept.
+type VersionHistory struct {
+	Doc   *Doc
+	Store VersionStore
+	Clock Clock // timestamps and interval of Start, SystemClock by default
+
+	captured *Snapshot // state of the doc after the last version was captured
+}
+
+// NewVersionHistory creates the version history of doc. The versions are stored in the root array
+// DefaultVersionsName of doc if store is nil. It returns ErrGCEnabled if doc uses GC.
+func NewVersionHistory(doc *Doc, store VersionStore) (*VersionHistory, error) {
+	if doc.GC {
+		return nil, ErrGCEnabled
+	}
+
+	if store == nil {
+		store = NewArrayVersionStore(doc.GetArray(DefaultVersionsName))
+	}
+
+	return &VersionHistory{
+		Doc:   doc,
+		Store: store,
+		Clock: SystemClock,
+	}, nil
+}
+
+// MigrateToNoGC creates a doc without GC that holds the state of doc, e.g. to replace a doc with GC before its
+// version history is created. The content that doc already collected can't be recovered, the first version
+// captures the state of the migration.
+func MigrateToNoGC(doc *Doc) *Doc {
+	migrated := NewDoc(doc.Guid, false, doc.GCFilter, doc.Meta, doc.AutoLoad)
+	ApplyUpdate(migrated, EncodeStateAsUpdate(doc, nil), nil)
+	return migrated
+}
+
+// Capture stores the current state of the doc as a version.
+func (h *VersionHistory) Capture(label, author string) (*Version, error) {
+	if h.Doc.GC {
+		return nil, ErrGCEnabled
+	}
+
+	version := &Version{
+		Label:     label,
+		Author:    author,
+		Timestamp: h.Clock.Now(),
+		Snapshot:  NewSnapshotByDoc(h.Doc),
+	}
+
+	if err := h.Store.Add(version); err != nil {
+		return nil, err
+	}
+
+	h.captured = NewSnapshotByDoc(h.Doc)
+	return version, nil
+}
+
+// Start captures a version of author every interval if the doc was changed, the version is labeled by label. The
+// doc is accessed while locker is locked, it must be held by all other users of the doc. locker may be nil if the
+// clock calls f where the doc is used anyway. Call stop to end the capturing.
+func (h *VersionHistory) Start(interval time.Duration, label, author string, locker sync.Locker) (stop func()) {
+	clock := h.Clock
+	if locker != nil {
+		clock = LockedClock{clock, locker}
+	}
+
+	return clock.Every(interval, func() {
+		if h.captured != nil && EqualSnapshots(h.captured, NewSnapshotByDoc(h.Doc)) {
+			return
+		}
+
+		if _, err := h.Capture(label, author); err != nil {
+			Logf("[crdt] capture version failed. err:%s", err.Error())
+		}
+	})
+}
+
+// Versions returns the stored versions in the order they were captured.
+func (h *VersionHistory) Versions() ([]*Version, error) {
+	return h.Store.Versions()
+}
+
+// Restore creates a new doc without GC with the state of version.
+func (h *VersionHistory) Restore(version *Version) (*Doc, error) {
+	return CreateDocFromSnapshot(h.Doc, version.Snapshot, NewDoc(h.Doc.Guid, false, h.Doc.GCFilter, nil, false))
+}
+
+// Diff returns the changes from version prev to version next, see DiffSnapshots. The versions that the history
+// stores in the doc are left out.
+func (h *VersionHistory) Diff(prev, next *Version) (*SnapshotDiff, error) {
+	diff, err := DiffSnapshots(h.Doc, prev.Snapshot, next.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if store, ok := h.Store.(*ArrayVersionStore); ok {
+		delete(diff.Arrays, typePath(store.Array))
+	}
+	return diff, nil
+}
+
+// ArrayVersionStore stores versions in a YArray, so that they are synced together with the doc. A version is an
+// object {label, author, timestamp, snapshot} whose snapshot is encoded by EncodeSnapshot.
+type ArrayVersionStore struct {
+	Array *YArray
+}
+
+func NewArrayVersionStore(array *YArray) *ArrayVersionStore {
+	return &ArrayVersionStore{Array: array}
+}
+
+func (s *ArrayVersionStore) Add(version *Version) error {
+	s.Array.Push(ArrayAny{Object{
+		"label":     version.Label,
+		"author":    version.Author,
+		"timestamp": Number(version.Timestamp),
+		"snapshot":  EncodeSnapshot(version.Snapshot),
+	}})
+	return nil
+}
+
+func (s *ArrayVersionStore) Versions() ([]*Version, error) {
+	var versions []*Version
+	for _, value := range s.Array.ToArray() {
+		obj, ok := value.(Object)
+		if !ok {
+			return nil, ErrInvalidData
+		}
+
+		label, _ := obj["label"].(string)
+		author, _ := obj["author"].(string)
+		data, ok := obj["snapshot"].([]byte)
+		if !ok {
+			return nil, ErrInvalidData
+		}
+
+		snapshot, err := decodeVersionSnapshot(data)
+		if err != nil {
+			return nil, err
+		}
+
+		version := &Version{Label: label, Author: author, Snapshot: snapshot}
+		switch timestamp := obj["timestamp"].(type) {
+		case Number:
+			version.Timestamp = int64(timestamp)
+		case int64:
+			version.Timestamp = timestamp
+		case float64:
+			version.Timestamp = int64(timestamp)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// PersistenceVersionStore stores versions as a JSON array under Name in a Persistence, apart from the doc.
+type PersistenceVersionStore struct {
+	Persistence Persistence
+	Name        string
+}
+
+func NewPersistenceVersionStore(persistence Persistence, name string) *PersistenceVersionStore {
+	return &PersistenceVersionStore{Persistence: persistence, Name: name}
+}
+
+// versionJSON is the JSON encoding of a version in a PersistenceVersionStore.
+type versionJSON struct {
+	Label     string `json:"label"`
+	Author    string `json:"author"`
+	Timestamp int64  `json:"timestamp"`
+	Snapshot  []byte `json:"snapshot"`
+}
+
+func (s *PersistenceVersionStore) Add(version *Version) error {
+	versions, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	versions = append(versions, versionJSON{
+		Label:     version.Label,
+		Author:    version.Author,
+		Timestamp: version.Timestamp,
+		Snapshot:  EncodeSnapshot(version.Snapshot),
+	})
+
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return err
+	}
+	return s.Persistence.Store(s.Name, data)
+}
+
+func (s *PersistenceVersionStore) Versions() ([]*Version, error) {
+	stored, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*Version, 0, len(stored))
+	for _, v := range stored {
+		snapshot, err := decodeVersionSnapshot(v.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, &Version{Label: v.Label, Author: v.Author, Timestamp: v.Timestamp, Snapshot: snapshot})
+	}
+	return versions, nil
+}
+
+func (s *PersistenceVersionStore) load() ([]versionJSON, error) {
+	data, err := s.Persistence.Load(s.Name)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var versions []versionJSON
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, ErrInvalidData
+	}
+	return versions, nil
+}
+
+func decodeVersionSnapshot(data []byte) (snapshot *Snapshot, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			snapshot, err = nil, ErrInvalidData
+		}
+	}()
+
+	snapshot = DecodeSnapshot(data)
+	if snapshot.Ds == nil {
+		return nil, ErrInvalidData
+	}
+	return snapshot, nil
+}
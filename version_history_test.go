@@ -0,0 +1,130 @@
+package y_crdt
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersionHistory(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	text := doc.GetText("text")
+	history, err := NewVersionHistory(doc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: 1000}
+	history.Clock = clock
+
+	text.Insert(0, "hello world", nil)
+	if _, err := history.Capture("draft", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	text.Delete(0, 6)
+	text.Insert(0, "goodbye ", nil)
+	clock.now = 2000
+	if _, err := history.Capture("final", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the versions are synced together with the doc
+	remote := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	ApplyUpdate(remote, EncodeStateAsUpdate(doc, nil), nil)
+	remoteHistory, err := NewVersionHistory(remote, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := remoteHistory.Versions()
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d %v", len(versions), err)
+	}
+
+	if v := versions[0]; v.Label != "draft" || v.Author != "alice" || v.Timestamp != 1000 {
+		t.Errorf("expected version draft of alice, got %+v", v)
+	}
+
+	if v := versions[1]; v.Label != "final" || v.Author != "bob" || v.Timestamp != 2000 {
+		t.Errorf("expected version final of bob, got %+v", v)
+	}
+
+	restored, err := remoteHistory.Restore(versions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := restored.GetText("text").ToString(); s != "hello world" {
+		t.Errorf("expected text of the draft, got %q", s)
+	}
+
+	if s := remote.GetText("text").ToString(); s != "goodbye world" {
+		t.Errorf("expected doc not to be changed by restore, got %q", s)
+	}
+}
+
+func TestVersionHistoryInterval(t *testing.T) {
+	doc := NewDoc("doc", false, DefaultGCFilter, nil, false)
+	persistence := memoryPersistence{}
+	history, err := NewVersionHistory(doc, NewPersistenceVersionStore(persistence, "doc/versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{}
+	history.Clock = clock
+	var mutex sync.Mutex
+	stop := history.Start(time.Minute, "auto", "server", &mutex)
+
+	doc.GetMap("map").(*YMap).Set("a", 1)
+	clock.Advance(time.Minute)
+	clock.Advance(time.Minute) // unchanged doc
+	doc.GetMap("map").(*YMap).Set("a", 2)
+	clock.Advance(time.Minute)
+	stop()
+	doc.GetMap("map").(*YMap).Set("a", 3)
+	clock.Advance(time.Minute)
+
+	versions, err := NewPersistenceVersionStore(persistence, "doc/versions").Versions()
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d %v", len(versions), err)
+	}
+
+	restored, err := history.Restore(versions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a := restored.GetMap("map").(*YMap).Get("a"); a != 1 {
+		t.Errorf("expected map of the first version, got %v", a)
+	}
+
+	persistence["doc/versions"] = []byte("[")
+	if _, err := history.Versions(); err != ErrInvalidData {
+		t.Errorf("expected invalid data, got %v", err)
+	}
+}
+
+func TestVersionHistoryGC(t *testing.T) {
+	doc := NewDoc("doc", true, DefaultGCFilter, nil, false)
+	doc.GetText("text").Insert(0, "hello", nil)
+	if _, err := NewVersionHistory(doc, nil); err != ErrGCEnabled {
+		t.Fatalf("expected ErrGCEnabled, got %v", err)
+	}
+
+	migrated := MigrateToNoGC(doc)
+	history, err := NewVersionHistory(migrated, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := history.Capture("migrated", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated.GetText("text").Delete(0, 5)
+
+	restored, err := history.Restore(version)
+	if err != nil || restored.GetText("text").ToString() != "hello" {
+		t.Errorf("expected restored text of the migrated doc, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package y_crdt
 const (
 	MessageSync = iota
 	MessageAwareness
+	MessageAuth
 )
 
 type UpdateHandler func([]byte)
@@ -10,14 +11,33 @@ type WSSharedDoc struct {
 	*Doc
 	Awareness *Awareness
 
+	// MaxMessageSize limits the size of the broadcast sync messages, larger updates are split into several
+	// messages. Zero means no limit.
+	MaxMessageSize int
+
+	// WritePolicy checks the updates of the connections before they are applied, nil allows all updates.
+	WritePolicy WritePolicy
+
 	awarenessUpdateHandler UpdateHandler
 	docUpdateHandler       UpdateHandler
+
+	hooks       []interface{}
+	connections int
+	loading     bool
 }
 
+// NewWSSharedDoc creates a shared doc whose awareness checks the outdated states by SystemClock, see NewAwareness.
+// Use NewWSSharedDocWithClock with a LockedClock if the doc is used by several goroutines.
 func NewWSSharedDoc(docID string, awarenessHandler UpdateHandler, docHandler UpdateHandler) *WSSharedDoc {
+	return NewWSSharedDocWithClock(docID, awarenessHandler, docHandler, SystemClock)
+}
+
+// NewWSSharedDocWithClock creates a shared doc whose awareness uses clock, e.g. a LockedClock to check the outdated
+// awareness states while the doc is locked. Destroy the doc to stop the check.
+func NewWSSharedDocWithClock(docID string, awarenessHandler UpdateHandler, docHandler UpdateHandler, clock Clock) *WSSharedDoc {
 	sd := &WSSharedDoc{}
 	sd.Doc = NewDoc(docID, true, DefaultGCFilter, nil, false)
-	sd.Awareness = NewAwareness(sd.Doc)
+	sd.Awareness = NewAwarenessWithClock(sd.Doc, clock)
 	sd.Awareness.SetLocalState(nil)
 	sd.awarenessUpdateHandler = awarenessHandler
 	sd.docUpdateHandler = docHandler
@@ -41,17 +61,94 @@ func NewWSSharedDoc(docID string, awarenessHandler UpdateHandler, docHandler Upd
 		}
 	}))
 
+	sd.Awareness.On("change", NewObserverHandler(func(v ...interface{}) {
+		sd.onAwareness(v[0].(Object), v[1])
+	}))
+
+	sd.Doc.On("update", NewObserverHandler(func(v ...interface{}) {
+		sd.afterApplyUpdate(v[0].([]byte), v[1], v[3].(*Transaction))
+	}))
+
 	// 文档更新消息广播
 	sd.Doc.On("update", NewObserverHandler(func(v ...interface{}) {
 		update := v[0].([]byte)
-		encoder := NewUpdateEncoderV1()
-		WriteVarUint(encoder.RestEncoder, MessageSync)
-		WriteUpdate(encoder, update)
+		if sd.docUpdateHandler == nil {
+			return
+		}
 
-		if sd.docUpdateHandler != nil {
+		if sd.MaxMessageSize <= 0 || len(update)+SyncMessageOverhead+1 <= sd.MaxMessageSize {
+			encoder := NewUpdateEncoderV1()
+			WriteVarUint(encoder.RestEncoder, MessageSync)
+			WriteUpdate(encoder, update)
 			sd.docUpdateHandler(encoder.ToUint8Array())
+			return
+		}
+
+		messages, err := EncodeUpdateMessages(update, sd.MaxMessageSize-1)
+		if err != nil {
+			Logf("[crdt] split update failed. err:%s", err.Error())
+			return
+		}
+
+		for _, message := range messages {
+			sd.docUpdateHandler(append([]byte{MessageSync}, message...))
 		}
 	}))
 
 	return sd
 }
+
+// SyncStep2Messages creates the reply to a sync step 1 of a client, split into messages that respect MaxMessageSize.
+func (sd *WSSharedDoc) SyncStep2Messages(encodedStateVector []byte) ([][]byte, error) {
+	if sd.MaxMessageSize <= 0 {
+		encoder := NewUpdateEncoderV1()
+		WriteVarUint(encoder.RestEncoder, MessageSync)
+		WriteSyncStep2(encoder, sd.Doc, encodedStateVector)
+		return [][]byte{encoder.ToUint8Array()}, nil
+	}
+
+	messages, err := EncodeSyncStep2Messages(sd.Doc, encodedStateVector, sd.MaxMessageSize-1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, message := range messages {
+		messages[i] = append([]byte{MessageSync}, message...)
+	}
+
+	return messages, nil
+}
+
+// ReadSyncMessage reads a sync message of conn, the MessageSync prefix is already read from decoder.
+// It returns the messages that are sent back to conn: the sync step 2 reply to a sync step 1, or a permission
+// denied message if an update is rejected by WritePolicy or a BeforeApplyUpdateHook. The update of conn is
+// applied with conn as origin.
+func (sd *WSSharedDoc) ReadSyncMessage(decoder *UpdateDecoderV1, conn interface{}) ([][]byte, error) {
+	messageType := ReadVarUint(decoder.RestDecoder)
+	data, err := ReadVarUint8Array(decoder.RestDecoder)
+	if err != nil {
+		return nil, err
+	}
+
+	switch messageType {
+	case MessageYjsSyncStep1:
+		return sd.SyncStep2Messages(data.([]byte))
+	case MessageYjsSyncStep2, MessageYjsUpdate:
+		if err = ApplyAuthorizedUpdate(sd.Doc, data.([]byte), conn, conn, sd.writePolicy(data.([]byte), conn)); err != nil {
+			if err == ErrInvalidData {
+				return nil, err
+			}
+			return [][]byte{EncodePermissionDenied(err.Error())}, err
+		}
+	}
+
+	return nil, nil
+}
+
+// EncodePermissionDenied creates the message that tells a connection why its update was rejected.
+func EncodePermissionDenied(reason string) []byte {
+	encoder := NewEncoder()
+	WriteVarUint(encoder, MessageAuth)
+	WritePermissionDenied(encoder, reason)
+	return encoder.Bytes()
+}
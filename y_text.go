@@ -888,7 +888,7 @@ func (y *YText) ToDelta(snapshot *Snapshot, prevSnapshot *Snapshot, computeYChan
 			n = n.Right
 		}
 		packStr()
-	}, SplitSnapshotAffectedStructs, true)
+	}, SplitSnapshotAffectedStructsOrigin, true)
 
 	return ops
 }
@@ -172,7 +172,7 @@ func (y *YXmlElement) Write(encoder *UpdateEncoderV1) {
 }
 
 func NewYXmlElement(nodeName string) *YXmlElement {
-	el := &YXmlElement{NodeName: nodeName}
+	el := &YXmlElement{YXmlFragment: *NewYXmlFragment(), NodeName: nodeName}
 	el.PrelimAttrs = make(map[string]interface{})
 	return el
 }